@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/yokitheyo/wb_level0/internal/config"
+	"github.com/yokitheyo/wb_level0/internal/validator"
+)
+
+// runCheckRules validates the sample orders against the configured rules and
+// prints the cases whose violations differ from the expected ones. It returns
+// 1 if any case failed and 2 if the rules or samples could not be loaded.
+func runCheckRules(args []string) int {
+	fs := flag.NewFlagSet("check-rules", flag.ExitOnError)
+	configPath := fs.String("config", "config/config.yaml", "path to the config file")
+	rulesPath := fs.String("rules", "", "rules file, overrides validation.rulesfile")
+	samplesPath := fs.String("samples", "config/validation_samples.yaml", "table of sample orders")
+	verbose := fs.Bool("v", false, "also print the cases that passed")
+	fs.Parse(args)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		return 2
+	}
+	if *rulesPath != "" {
+		cfg.Validation.RulesFile = *rulesPath
+	}
+
+	v, err := validator.NewFromConfig(&cfg.Validation)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load rules: %v\n", err)
+		return 2
+	}
+	samples, err := validator.LoadSampleFile(*samplesPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+	results, err := v.RunSamples(samples)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Passed() {
+			if *verbose {
+				fmt.Printf("ok    %s\n", r.Name)
+			}
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL  %s\n", r.Name)
+		for _, m := range r.Missing {
+			fmt.Printf("        missing:    %s\n", m)
+		}
+		for _, u := range r.Unexpected {
+			fmt.Printf("        unexpected: %s\n", u)
+		}
+	}
+
+	fmt.Printf("%d/%d cases passed\n", len(results)-failed, len(results))
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
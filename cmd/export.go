@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/yokitheyo/wb_level0/internal/config"
+	"github.com/yokitheyo/wb_level0/internal/database"
+	"github.com/yokitheyo/wb_level0/internal/export"
+	"github.com/yokitheyo/wb_level0/internal/models"
+	"github.com/yokitheyo/wb_level0/internal/repository"
+	"go.uber.org/zap"
+)
+
+// runExport writes the orders matching the filter flags to a file, reading
+// them straight from the database. It returns the process exit code.
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	configPath := fs.String("config", "config/config.yaml", "path to the config file")
+	formatName := fs.String("format", "csv", "csv, ndjson or parquet")
+	out := fs.String("out", "", "output file (default orders.<format>)")
+	var filter repository.OrderFilter
+	fs.StringVar(&filter.CustomerID, "customer-id", "", "filter by customer_id")
+	fs.StringVar(&filter.TrackNumber, "track-number", "", "filter by track_number")
+	fs.StringVar(&filter.DeliveryService, "delivery-service", "", "filter by delivery_service")
+	fs.StringVar(&filter.Currency, "currency", "", "filter by payment currency")
+	fs.StringVar(&filter.Provider, "provider", "", "filter by payment provider")
+	fs.StringVar(&filter.Brand, "brand", "", "filter by item brand")
+	fs.IntVar(&filter.NmID, "nm-id", 0, "filter by item nm_id")
+	createdFrom := fs.String("created-from", "", "earliest date_created, RFC 3339 or YYYY-MM-DD")
+	createdTo := fs.String("created-to", "", "date_created upper bound (exclusive), RFC 3339 or YYYY-MM-DD")
+	fs.Parse(args)
+
+	format, err := export.ParseFormat(*formatName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if filter.CreatedFrom, err = parseTime(*createdFrom); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -created-from: %v\n", err)
+		return 2
+	}
+	if filter.CreatedTo, err = parseTime(*createdTo); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -created-to: %v\n", err)
+		return 2
+	}
+	if *out == "" {
+		*out = "orders." + string(format)
+	}
+
+	logger, err := zap.NewProduction()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to initialize logger: %v\n", err)
+		return 2
+	}
+	defer logger.Sync()
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		logger.Error("failed to load config", zap.Error(err))
+		return 2
+	}
+	db, err := database.NewDatabase(&cfg.Database, logger)
+	if err != nil {
+		logger.Error("failed to connect to database", zap.Error(err))
+		return 2
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	written, err := exportToFile(ctx, repository.NewOrderRepository(db.GetPool(), logger), filter, format, *out)
+	if err != nil {
+		logger.Error("failed to export orders", zap.Error(err), zap.String("out", *out))
+		return 1
+	}
+	logger.Info("orders exported", zap.Int("num_orders", written), zap.String("out", *out))
+	return 0
+}
+
+// exportToFile removes the file again if the export fails, so that a
+// truncated export is never mistaken for a complete one.
+func exportToFile(ctx context.Context,
+	repo repository.OrderRepository,
+	filter repository.OrderFilter,
+	format export.Format,
+	path string) (written int, err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("failed to close output file: %w", closeErr)
+		}
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+
+	w, err := export.NewWriter(format, f)
+	if err != nil {
+		return 0, err
+	}
+	err = repo.StreamOrders(ctx, filter, func(order models.Order) error {
+		if err := w.Write(order); err != nil {
+			return err
+		}
+		written++
+		return nil
+	})
+	if err != nil {
+		return written, err
+	}
+	return written, w.Close()
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	return time.Parse(time.DateOnly, s)
+}
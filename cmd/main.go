@@ -10,6 +10,17 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "verify":
+			os.Exit(runVerify(os.Args[2:]))
+		case "export":
+			os.Exit(runExport(os.Args[2:]))
+		case "check-rules":
+			os.Exit(runCheckRules(os.Args[2:]))
+		}
+	}
+
 	dir, _ := os.Getwd()
 	fmt.Println("Working dir:", dir)
 
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/yokitheyo/wb_level0/internal/services"
+)
+
+// runVerify asks a running service to compare its cache with the database,
+// since the cache only exists inside that process. It prints the report and
+// returns 1 if drift was found and 2 if the check could not be run.
+func runVerify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	addr := fs.String("addr", "http://localhost:8081", "address of the running service")
+	repair := fs.Bool("repair", false, "fix cache entries that differ from the database")
+	checkMissing := fs.Bool("check-missing", false, "also report stored orders missing from the cache")
+	timeout := fs.Duration("timeout", 10*time.Minute, "how long to wait for the report")
+	fs.Parse(args)
+
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		fmt.Fprintln(os.Stderr, "ADMIN_TOKEN must be set")
+		return 2
+	}
+
+	query := url.Values{}
+	query.Set("repair", strconv.FormatBool(*repair))
+	query.Set("check_missing", strconv.FormatBool(*checkMissing))
+
+	req, err := http.NewRequest(http.MethodPost, *addr+"/admin/cache/verify?"+query.Encode(), nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to build request: %v\n", err)
+		return 2
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := &http.Client{Timeout: *timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to verify cache: %v\n", err)
+		return 2
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read response: %v\n", err)
+		return 2
+	}
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "verification failed: %s: %s\n", resp.Status, body)
+		return 2
+	}
+
+	var report services.VerificationReport
+	if err := json.Unmarshal(body, &report); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to decode report: %v\n", err)
+		return 2
+	}
+
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+
+	if report.Drifted() > 0 && !*repair {
+		return 1
+	}
+	return 0
+}
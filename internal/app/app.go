@@ -16,6 +16,7 @@ import (
 	"github.com/yokitheyo/wb_level0/internal/kafka"
 	"github.com/yokitheyo/wb_level0/internal/repository"
 	"github.com/yokitheyo/wb_level0/internal/services"
+	"github.com/yokitheyo/wb_level0/internal/validator"
 	"go.uber.org/zap"
 )
 
@@ -24,7 +25,10 @@ type App struct {
 	logger   *zap.Logger
 	db       *database.Database
 	server   *http.Server
+	cache    cache.OrderCache
+	service  services.OrderService
 	consumer *kafka.Consumer
+	dlq      *kafka.DeadLetterQueue
 	cancel   context.CancelFunc
 }
 
@@ -48,23 +52,54 @@ func NewApp(configPath string, logger *zap.Logger) (*App, error) {
 
 func (a *App) Start() error {
 	orderRepo := repository.NewOrderRepository(a.db.GetPool(), a.logger)
-	orderCache := cache.NewOrderCache(a.logger)
-	orderService := services.NewOrderService(orderRepo, orderCache, a.logger)
-
-	if err := orderService.RestoreCache(context.Background()); err != nil {
+	orderCache, err := cache.New(&a.config.Cache, a.logger)
+	if err != nil {
+		return err
+	}
+	missing := cache.NewNegativeCache(a.config.Cache.NegativeTTL)
+	orderDecoder, err := validator.NewDecoder(&a.config.Decoding)
+	if err != nil {
 		return err
 	}
+	orderValidator, err := validator.NewFromConfig(&a.config.Validation)
+	if err != nil {
+		return err
+	}
+	orderService := services.NewOrderService(orderRepo, orderCache, missing, orderDecoder, orderValidator, a.logger)
+	a.cache = orderCache
+	a.service = orderService
 
 	ctx, cancel := context.WithCancel(context.Background())
 	a.cancel = cancel
 
-	consumer := kafka.NewConsumer(
-		a.config.Kafka.Brokers,
-		a.config.Kafka.Topic,
-		a.config.Kafka.GroupID,
-		orderService,
-		a.logger,
-	)
+	go cache.RunSweeper(ctx, orderCache, missing, a.config.Cache.SweepInterval, a.logger)
+	go validator.RunReloader(ctx, orderValidator, a.config.Validation.ReloadInterval, a.logger)
+
+	if a.config.Cache.BackgroundWarmup {
+		go func() {
+			if err := a.warmupCache(ctx); err != nil {
+				a.logger.Error("background cache warm-up failed", zap.Error(err))
+			}
+		}()
+	} else if err := a.warmupCache(ctx); err != nil {
+		cancel()
+		return err
+	}
+
+	go a.runSnapshots(ctx, a.config.Cache.SnapshotInterval)
+	go a.runVerifier(ctx, services.VerifyOptions{
+		Repair:       a.config.Verifier.Repair,
+		CheckMissing: a.config.Verifier.CheckMissing,
+	}, a.config.Verifier.Interval)
+	go a.runProcessedCleanup(ctx, a.config.Idempotency.Retention, a.config.Idempotency.CleanupInterval)
+
+	var dlq kafka.DeadLetterPublisher
+	if a.config.Kafka.DLQTopic != "" {
+		a.dlq = kafka.NewDeadLetterQueue(a.config.Kafka.Brokers, a.config.Kafka.DLQTopic, a.logger)
+		dlq = a.dlq
+	}
+
+	consumer := kafka.NewConsumer(&a.config.Kafka, orderService, dlq, a.logger)
 	a.consumer = consumer
 	consumer.Start(ctx)
 
@@ -94,6 +129,13 @@ func (a *App) setupRouter(orderService services.OrderService) *gin.Engine {
 	orderHandler := handlers.NewOrderHandler(orderService, a.logger)
 	orderHandler.RegisterRoutes(router)
 
+	if a.config.Admin.Token != "" {
+		adminHandler := handlers.NewAdminHandler(orderService, a.config.Admin.Token, a.logger)
+		adminHandler.RegisterRoutes(router)
+	} else {
+		a.logger.Info("admin endpoints disabled, no admin token configured")
+	}
+
 	return router
 }
 
@@ -104,6 +146,23 @@ func (a *App) Stop() error {
 		a.cancel()
 	}
 
+	if a.consumer != nil {
+		select {
+		case <-a.consumer.Done():
+		case <-time.After(10 * time.Second):
+			a.logger.Warn("timed out waiting for kafka consumer to stop")
+		}
+	}
+
+	// taken after the consumer stopped so that no processed order is missing
+	a.writeSnapshot()
+
+	if a.dlq != nil {
+		if err := a.dlq.Close(); err != nil {
+			a.logger.Error("failed to close dead-letter producer", zap.Error(err))
+		}
+	}
+
 	if a.server != nil {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
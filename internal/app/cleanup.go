@@ -0,0 +1,27 @@
+package app
+
+import (
+	"context"
+	"time"
+)
+
+// runProcessedCleanup deletes processed message keys older than retention
+// every interval until ctx is cancelled.
+func (a *App) runProcessedCleanup(ctx context.Context, retention, interval time.Duration) {
+	if retention <= 0 || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// failures are logged by the service and retried on the next tick
+			a.service.CleanupProcessedMessages(ctx, retention)
+		}
+	}
+}
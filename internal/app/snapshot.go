@@ -0,0 +1,91 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/yokitheyo/wb_level0/internal/cache"
+	"github.com/yokitheyo/wb_level0/internal/services"
+	"go.uber.org/zap"
+)
+
+// snapshotOverlap is subtracted from the snapshot high-water mark so that
+// orders committed while the snapshot was being written are not missed.
+const snapshotOverlap = time.Minute
+
+// warmupCache fills the cache on startup: from the snapshot if one can be
+// loaded, topped up with orders changed since, or else from the database.
+func (a *App) warmupCache(ctx context.Context) error {
+	path := a.config.Cache.SnapshotPath
+	if path == "" {
+		return a.service.RestoreCache(ctx)
+	}
+
+	start := time.Now()
+	info, err := cache.LoadSnapshot(path, a.cache)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		a.logger.Info("no cache snapshot found", zap.String("path", path))
+		return a.service.RestoreCache(ctx)
+	case err != nil:
+		a.logger.Warn("failed to load cache snapshot, restoring from database", zap.Error(err), zap.String("path", path))
+		return a.service.RestoreCache(ctx)
+	case info.Orders == 0:
+		return a.service.RestoreCache(ctx)
+	}
+
+	a.logger.Info("cache snapshot loaded",
+		zap.String("path", path),
+		zap.Int("num_orders", info.Orders),
+		zap.Time("created_at", info.CreatedAt),
+		zap.Time("high_water", info.HighWater),
+		zap.Duration("duration", time.Since(start)),
+	)
+	return a.service.RestoreCacheSince(ctx, info.HighWater.Add(-snapshotOverlap))
+}
+
+// runSnapshots saves the cache every interval until ctx is cancelled.
+func (a *App) runSnapshots(ctx context.Context, interval time.Duration) {
+	if a.config.Cache.SnapshotPath == "" || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.writeSnapshot()
+		}
+	}
+}
+
+// writeSnapshot saves the cache unless warm-up has not completed, in which
+// case the snapshot would be missing orders that are only in the database.
+func (a *App) writeSnapshot() {
+	path := a.config.Cache.SnapshotPath
+	if path == "" || a.service == nil {
+		return
+	}
+	if state := a.service.GetWarmupStatus().State; state != services.WarmupDone {
+		a.logger.Debug("skipping cache snapshot until warm-up is done", zap.String("warmup_state", string(state)))
+		return
+	}
+
+	start := time.Now()
+	info, err := cache.WriteSnapshot(path, a.cache)
+	if err != nil {
+		a.logger.Error("failed to write cache snapshot", zap.Error(err), zap.String("path", path))
+		return
+	}
+	a.logger.Info("cache snapshot written",
+		zap.String("path", path),
+		zap.Int("num_orders", info.Orders),
+		zap.Duration("duration", time.Since(start)),
+	)
+}
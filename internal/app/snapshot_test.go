@@ -0,0 +1,99 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yokitheyo/wb_level0/internal/cache"
+	"github.com/yokitheyo/wb_level0/internal/config"
+	"github.com/yokitheyo/wb_level0/internal/models"
+	"github.com/yokitheyo/wb_level0/internal/services"
+	"go.uber.org/zap"
+)
+
+// restoreRecorder records how the cache was restored from the database.
+type restoreRecorder struct {
+	services.OrderService
+	full  int
+	since []time.Time
+}
+
+func (r *restoreRecorder) RestoreCache(context.Context) error {
+	r.full++
+	return nil
+}
+
+func (r *restoreRecorder) RestoreCacheSince(_ context.Context, since time.Time) error {
+	r.since = append(r.since, since)
+	return nil
+}
+
+func newSnapshotApp(path string) (*App, *restoreRecorder) {
+	service := &restoreRecorder{}
+	logger := zap.NewNop()
+	return &App{
+		config:  &config.Config{Cache: config.CacheConfig{SnapshotPath: path}},
+		logger:  logger,
+		cache:   cache.NewOrderCache(logger),
+		service: service,
+	}, service
+}
+
+func TestWarmupLoadsDeltaSinceSnapshot(t *testing.T) {
+	highWater := time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC)
+	source := cache.NewOrderCache(zap.NewNop())
+	source.LoadFromDB([]models.Order{
+		{OrderUID: "a", Version: 1, UpdatedAt: highWater.Add(-time.Hour)},
+		{OrderUID: "b", Version: 1, UpdatedAt: highWater},
+	})
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	if _, err := cache.WriteSnapshot(path, source); err != nil {
+		t.Fatal(err)
+	}
+
+	a, service := newSnapshotApp(path)
+	if err := a.warmupCache(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if service.full != 0 || len(service.since) != 1 {
+		t.Fatalf("expected one delta restore, got %d full and %d delta", service.full, len(service.since))
+	}
+	if want := highWater.Add(-snapshotOverlap); !service.since[0].Equal(want) {
+		t.Fatalf("expected the delta to start at %v, got %v", want, service.since[0])
+	}
+	if _, ok := a.cache.Peek("a"); !ok {
+		t.Fatal("expected the snapshot orders to be cached")
+	}
+}
+
+func TestWarmupFallsBackToFullRestore(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.snapshot")
+	if _, err := cache.WriteSnapshot(empty, cache.NewOrderCache(zap.NewNop())); err != nil {
+		t.Fatal(err)
+	}
+	corrupted := filepath.Join(dir, "corrupted.snapshot")
+	if err := os.WriteFile(corrupted, []byte("not a snapshot"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"missing":   filepath.Join(dir, "missing.snapshot"),
+		"corrupted": corrupted,
+		"empty":     empty,
+	}
+	for name, path := range tests {
+		t.Run(name, func(t *testing.T) {
+			a, service := newSnapshotApp(path)
+			if err := a.warmupCache(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if service.full != 1 || len(service.since) != 0 {
+				t.Fatalf("expected a full restore, got %d full and %d delta", service.full, len(service.since))
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/yokitheyo/wb_level0/internal/services"
+)
+
+// runVerifier compares the cache with the database every interval until ctx
+// is cancelled. Runs are skipped until warm-up has completed.
+func (a *App) runVerifier(ctx context.Context, opts services.VerifyOptions, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if a.service.GetWarmupStatus().State != services.WarmupDone {
+				continue
+			}
+			// failures are logged and recorded in the report by the service
+			a.service.VerifyCache(ctx, opts)
+		}
+	}
+}
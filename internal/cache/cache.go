@@ -1,8 +1,12 @@
 package cache
 
 import (
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/yokitheyo/wb_level0/internal/config"
 	"github.com/yokitheyo/wb_level0/internal/models"
 	"go.uber.org/zap"
 )
@@ -10,64 +14,390 @@ import (
 type OrderCache interface {
 	Set(orderUID string, order models.Order)
 	Get(orderUID string) (models.Order, bool)
+	// Peek is Get without counting a hit or miss or touching the eviction
+	// policy, for inspecting the cache without affecting it.
+	Peek(orderUID string) (models.Order, bool)
 	LoadFromDB(orders []models.Order)
+	// FindByTrackNumber and FindByCustomer return the cached orders with the
+	// given track number or customer ID, in no particular order.
+	FindByTrackNumber(trackNumber string) []models.Order
+	FindByCustomer(customerID string) []models.Order
+	// Bounded reports whether orders can leave the cache on their own,
+	// through eviction or expiry.
+	Bounded() bool
+	Delete(orderUID string) bool
+	DeleteByPrefix(prefix string) int
+	Flush() int
+	RemoveExpired() int
+	// Range calls fn for every live order until fn returns false. fn runs
+	// under the cache lock and must not call back into the cache.
+	Range(fn func(order models.Order) bool)
+	// ListUIDs returns up to limit cached order UIDs that start with prefix,
+	// in ascending order beginning after the given UID.
+	ListUIDs(after, prefix string, limit int) []string
 	GetStats() CacheStats
 }
 
 type CacheStats struct {
-	TotalOrders int      `json:"total_orders"`
-	OrderUIDs   []string `json:"order_uids"`
+	TotalOrders     int       `json:"total_orders"`
+	Hits            uint64    `json:"hits"`
+	Misses          uint64    `json:"misses"`
+	HitRatio        float64   `json:"hit_ratio"`
+	Evictions       uint64    `json:"evictions"`
+	Expired         uint64    `json:"expired"`
+	ApproxBytes     int64     `json:"approx_bytes"`
+	TTL             string    `json:"ttl"`
+	LastUpdated     time.Time `json:"last_updated"`
+	LoadDuration    string    `json:"load_duration"`
+	NegativeTTL     string    `json:"negative_ttl"`
+	NegativeEntries int       `json:"negative_entries"`
 }
 
+func (s *CacheStats) updateHitRatio() {
+	if lookups := s.Hits + s.Misses; lookups > 0 {
+		s.HitRatio = float64(s.Hits) / float64(lookups)
+	}
+}
+
+type cacheEntry struct {
+	order     models.Order
+	size      int64
+	expiresAt time.Time
+}
+
+// orderCache keeps orders in a map. With an eviction policy it holds at
+// most maxEntries orders and roughly maxBytes of order data (a zero limit is
+// not enforced); with a ttl entries expire and are dropped by RemoveExpired.
 type orderCache struct {
-	mu     sync.RWMutex
-	cache  map[string]models.Order
-	logger *zap.Logger
+	mu         sync.RWMutex
+	cache      map[string]cacheEntry
+	byTrack    secondaryIndex
+	byCustomer secondaryIndex
+	policy     evictionPolicy
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+	ttl        time.Duration
+	hits       atomic.Uint64
+	misses     atomic.Uint64
+	evictions  atomic.Uint64
+	expired    atomic.Uint64
+	updated    atomic.Int64
+	now        func() time.Time // replaced in tests
+	logger     *zap.Logger
+}
+
+// New builds the cache described by cfg: an unbounded map unless an eviction
+// policy is configured, split into shards if more than one is requested.
+func New(cfg *config.CacheConfig, logger *zap.Logger) (OrderCache, error) {
+	if cfg.Shards <= 1 {
+		return newConfiguredCache(cfg, 1, logger)
+	}
+
+	shards := make([]*orderCache, cfg.Shards)
+	for i := range shards {
+		s, err := newConfiguredCache(cfg, cfg.Shards, logger)
+		if err != nil {
+			return nil, err
+		}
+		shards[i] = s
+	}
+	return newShardedCache(shards), nil
+}
+
+func newConfiguredCache(cfg *config.CacheConfig, shards int, logger *zap.Logger) (*orderCache, error) {
+	c := newOrderCache(cfg.TTL, logger)
+	if cfg.Policy == "" || cfg.Policy == PolicyNone {
+		return c, nil
+	}
+
+	policy, err := newEvictionPolicy(cfg.Policy)
+	if err != nil {
+		return nil, err
+	}
+	c.policy = policy
+	c.maxEntries = ceilDiv(cfg.MaxEntries, shards)
+	c.maxBytes = int64(ceilDiv(int(cfg.MaxBytes), shards))
+	return c, nil
+}
+
+func ceilDiv(n, d int) int {
+	return (n + d - 1) / d
 }
 
 func NewOrderCache(logger *zap.Logger) OrderCache {
+	return newOrderCache(0, logger)
+}
+
+func newOrderCache(ttl time.Duration, logger *zap.Logger) *orderCache {
 	return &orderCache{
-		cache:  make(map[string]models.Order),
-		logger: logger,
+		cache:      make(map[string]cacheEntry),
+		byTrack:    make(secondaryIndex),
+		byCustomer: make(secondaryIndex),
+		ttl:        ttl,
+		now:        time.Now,
+		logger:     logger,
 	}
 }
 
 func (c *orderCache) Set(orderUID string, order models.Order) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.cache[orderUID] = order
+	c.put(orderUID, order, c.now())
+	c.evict()
 	c.logger.Debug("order added to cache", zap.String("order_uid", orderUID))
 }
 
 func (c *orderCache) Get(orderUID string) (models.Order, bool) {
+	// the eviction policy records every access, so it needs the write lock
+	if c.policy != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+	} else {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+	}
+
+	e, ok := c.cache[orderUID]
+	if !ok || c.isExpired(e, c.now()) {
+		c.misses.Add(1)
+		return models.Order{}, false
+	}
+	c.hits.Add(1)
+	if c.policy != nil {
+		c.policy.touch(orderUID)
+	}
+	return e.order, true
+}
+
+func (c *orderCache) Peek(orderUID string) (models.Order, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	order, ok := c.cache[orderUID]
-	return order, ok
+
+	e, ok := c.cache[orderUID]
+	if !ok || c.isExpired(e, c.now()) {
+		return models.Order{}, false
+	}
+	return e.order, true
 }
 
+// LoadFromDB merges orders read from the database into the cache. It may be
+// called repeatedly with consecutive pages while the cache is in use; an
+// entry that is already newer than the loaded one is kept.
 func (c *orderCache) LoadFromDB(orders []models.Order) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	now := c.now()
 	for _, order := range orders {
-		c.cache[order.OrderUID] = order
+		if e, ok := c.cache[order.OrderUID]; ok && !c.isExpired(e, now) && isNewer(e.order, order) {
+			continue
+		}
+		c.put(order.OrderUID, order, now)
 	}
+	c.evict()
 
-	c.logger.Info("cache loaded from database", zap.Int("orders_count", len(orders)))
+	c.logger.Debug("orders loaded from database", zap.Int("orders_count", len(orders)))
 }
 
-func (c *orderCache) GetStats() CacheStats {
+func (c *orderCache) FindByTrackNumber(trackNumber string) []models.Order {
+	return c.find(c.byTrack, trackNumber)
+}
+
+func (c *orderCache) FindByCustomer(customerID string) []models.Order {
+	return c.find(c.byCustomer, customerID)
+}
+
+func (c *orderCache) find(idx secondaryIndex, key string) []models.Order {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	orderUIDs := make([]string, 0, len(c.cache))
+	now := c.now()
+	var orders []models.Order
+	for uid := range idx[key] {
+		if e := c.cache[uid]; !c.isExpired(e, now) {
+			orders = append(orders, e.order)
+		}
+	}
+	return orders
+}
+
+func (c *orderCache) Bounded() bool {
+	return c.policy != nil || c.ttl > 0
+}
+
+func (c *orderCache) Delete(orderUID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.cache[orderUID]; !ok {
+		return false
+	}
+	c.remove(orderUID)
+	return true
+}
+
+// DeleteByPrefix removes every order whose UID starts with prefix and
+// returns how many were removed.
+func (c *orderCache) DeleteByPrefix(prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
 	for uid := range c.cache {
-		orderUIDs = append(orderUIDs, uid)
+		if strings.HasPrefix(uid, prefix) {
+			c.remove(uid)
+			removed++
+		}
+	}
+	return removed
+}
+
+func (c *orderCache) Flush() int {
+	return c.DeleteByPrefix("")
+}
+
+// RemoveExpired drops every entry whose ttl has passed and returns how many
+// were removed.
+func (c *orderCache) RemoveExpired() int {
+	if c.ttl <= 0 {
+		return 0
 	}
 
-	return CacheStats{
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	removed := 0
+	for uid, e := range c.cache {
+		if c.isExpired(e, now) {
+			c.remove(uid)
+			removed++
+		}
+	}
+	c.expired.Add(uint64(removed))
+	return removed
+}
+
+func (c *orderCache) Range(fn func(order models.Order) bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := c.now()
+	for _, e := range c.cache {
+		if c.isExpired(e, now) {
+			continue
+		}
+		if !fn(e.order) {
+			return
+		}
+	}
+}
+
+// ListUIDs scans the whole map but keeps only the page being built, so a
+// page costs O(n log limit) rather than a sort of every cached UID.
+func (c *orderCache) ListUIDs(after, prefix string, limit int) []string {
+	if limit <= 0 {
+		return nil
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := c.now()
+	page := newSmallestUIDs(limit)
+	for uid, e := range c.cache {
+		if uid <= after || !strings.HasPrefix(uid, prefix) || c.isExpired(e, now) {
+			continue
+		}
+		page.offer(uid)
+	}
+	return page.sorted()
+}
+
+func (c *orderCache) GetStats() CacheStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	stats := CacheStats{
 		TotalOrders: len(c.cache),
-		OrderUIDs:   orderUIDs,
+		Hits:        c.hits.Load(),
+		Misses:      c.misses.Load(),
+		Evictions:   c.evictions.Load(),
+		Expired:     c.expired.Load(),
+		ApproxBytes: c.bytes,
+		TTL:         c.ttl.String(),
+	}
+	if updated := c.updated.Load(); updated > 0 {
+		stats.LastUpdated = time.Unix(0, updated)
+	}
+	stats.updateHitRatio()
+	return stats
+}
+
+func (c *orderCache) put(orderUID string, order models.Order, now time.Time) {
+	e := cacheEntry{order: order, size: approxOrderSize(order)}
+	if c.ttl > 0 {
+		e.expiresAt = now.Add(c.ttl)
+	}
+	old, ok := c.cache[orderUID]
+	if ok {
+		c.unindex(old.order)
+	}
+	c.bytes += e.size - old.size
+	if c.policy != nil {
+		c.policy.add(orderUID)
+	}
+	c.cache[orderUID] = e
+	c.byTrack.add(order.TrackNumber, orderUID)
+	c.byCustomer.add(order.CustomerID, orderUID)
+	c.updated.Store(now.UnixNano())
+}
+
+func (c *orderCache) remove(orderUID string) {
+	e := c.cache[orderUID]
+	c.bytes -= e.size
+	c.unindex(e.order)
+	if c.policy != nil {
+		c.policy.remove(orderUID)
+	}
+	delete(c.cache, orderUID)
+}
+
+func (c *orderCache) unindex(order models.Order) {
+	c.byTrack.remove(order.TrackNumber, order.OrderUID)
+	c.byCustomer.remove(order.CustomerID, order.OrderUID)
+}
+
+func (c *orderCache) evict() {
+	if c.policy == nil {
+		return
+	}
+	for c.overLimit() {
+		uid, ok := c.policy.victim()
+		if !ok {
+			return
+		}
+		c.remove(uid)
+		c.evictions.Add(1)
+		c.logger.Debug("order evicted from cache", zap.String("order_uid", uid))
+	}
+}
+
+func (c *orderCache) overLimit() bool {
+	if c.maxEntries > 0 && len(c.cache) > c.maxEntries {
+		return true
+	}
+	return c.maxBytes > 0 && c.bytes > c.maxBytes && len(c.cache) > 1
+}
+
+func (c *orderCache) isExpired(e cacheEntry, now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.After(e.expiresAt)
+}
+
+func isNewer(a, b models.Order) bool {
+	if a.Version != b.Version {
+		return a.Version > b.Version
 	}
+	return a.UpdatedAt.After(b.UpdatedAt)
 }
@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/yokitheyo/wb_level0/internal/config"
+	"github.com/yokitheyo/wb_level0/internal/models"
+	"go.uber.org/zap"
+)
+
+const benchOrders = 100000
+
+var benchOrderSet = func() []models.Order {
+	orders := make([]models.Order, benchOrders)
+	for i := range orders {
+		orders[i] = models.Order{
+			OrderUID:    fmt.Sprintf("bench-%08d", i),
+			TrackNumber: fmt.Sprintf("WBILMBENCH%08d", i),
+			Items:       []models.Item{{ChrtID: i, Name: "Mascaras", Brand: "Vivienne Sabo"}},
+		}
+	}
+	return orders
+}()
+
+// benchConfigs covers every eviction policy, unsharded and sharded. Bounded
+// caches hold half of the orders, so that Set also pays for evictions.
+type benchConfig struct {
+	name string
+	cfg  config.CacheConfig
+}
+
+func benchConfigs() []benchConfig {
+	var configs []benchConfig
+	for _, policy := range []string{PolicyNone, PolicyLRU, PolicyLFU} {
+		maxEntries := 0
+		if policy != PolicyNone {
+			maxEntries = benchOrders / 2
+		}
+		for _, shards := range []int{1, 16} {
+			configs = append(configs, benchConfig{
+				name: fmt.Sprintf("%s/shards-%d", policy, shards),
+				cfg:  config.CacheConfig{Policy: policy, Shards: shards, MaxEntries: maxEntries},
+			})
+		}
+	}
+	return configs
+}
+
+func newBenchCache(b *testing.B, cfg config.CacheConfig) OrderCache {
+	b.Helper()
+	c, err := New(&cfg, zap.NewNop())
+	if err != nil {
+		b.Fatal(err)
+	}
+	c.LoadFromDB(benchOrderSet)
+	return c
+}
+
+func BenchmarkGet(b *testing.B) {
+	for _, bc := range benchConfigs() {
+		b.Run(bc.name, func(b *testing.B) {
+			c := newBenchCache(b, bc.cfg)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				rnd := rand.New(rand.NewSource(rand.Int63()))
+				for pb.Next() {
+					c.Get(benchOrderSet[rnd.Intn(benchOrders)].OrderUID)
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkSet(b *testing.B) {
+	for _, bc := range benchConfigs() {
+		b.Run(bc.name, func(b *testing.B) {
+			c := newBenchCache(b, bc.cfg)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				rnd := rand.New(rand.NewSource(rand.Int63()))
+				for pb.Next() {
+					order := benchOrderSet[rnd.Intn(benchOrders)]
+					c.Set(order.OrderUID, order)
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkMixed interleaves Get and Set from every goroutine, which shows
+// whether writers block readers: writePercent of the operations are Sets.
+func BenchmarkMixed(b *testing.B) {
+	for _, writePercent := range []int{10, 50} {
+		for _, bc := range benchConfigs() {
+			b.Run(fmt.Sprintf("writes-%d/%s", writePercent, bc.name), func(b *testing.B) {
+				c := newBenchCache(b, bc.cfg)
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					rnd := rand.New(rand.NewSource(rand.Int63()))
+					for pb.Next() {
+						order := benchOrderSet[rnd.Intn(benchOrders)]
+						if rnd.Intn(100) < writePercent {
+							c.Set(order.OrderUID, order)
+						} else {
+							c.Get(order.OrderUID)
+						}
+					}
+				})
+			})
+		}
+	}
+}
+
+// BenchmarkListUIDs pages through the middle of the cache, as the verifier
+// and the admin listing do.
+func BenchmarkListUIDs(b *testing.B) {
+	for _, bc := range benchConfigs() {
+		if bc.cfg.Policy != PolicyNone {
+			continue
+		}
+		b.Run(bc.name, func(b *testing.B) {
+			c := newBenchCache(b, bc.cfg)
+			after := benchOrderSet[benchOrders/2].OrderUID
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c.ListUIDs(after, "", 100)
+			}
+		})
+	}
+}
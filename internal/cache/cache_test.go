@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/yokitheyo/wb_level0/internal/config"
+	"github.com/yokitheyo/wb_level0/internal/models"
+	"go.uber.org/zap"
+)
+
+func testOrder(uid string) models.Order {
+	return models.Order{
+		OrderUID:    uid,
+		TrackNumber: "WBILM" + uid,
+		CustomerID:  "customer",
+		Items:       []models.Item{{ChrtID: 1, Name: "Mascaras", Brand: "Vivienne Sabo"}},
+	}
+}
+
+func newTestCache(t *testing.T, cfg config.CacheConfig) OrderCache {
+	t.Helper()
+	c, err := New(&cfg, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCacheMaxEntries(t *testing.T) {
+	c := newTestCache(t, config.CacheConfig{Policy: PolicyLRU, MaxEntries: 3})
+	for _, uid := range []string{"a", "b", "c"} {
+		c.Set(uid, testOrder(uid))
+	}
+	c.Get("a")
+	c.Set("d", testOrder("d"))
+
+	if _, ok := c.Peek("b"); ok {
+		t.Error("expected the least recently used order to be evicted")
+	}
+	for _, uid := range []string{"a", "c", "d"} {
+		if _, ok := c.Peek(uid); !ok {
+			t.Errorf("expected %s to stay cached", uid)
+		}
+	}
+	stats := c.GetStats()
+	if stats.TotalOrders != 3 || stats.Evictions != 1 {
+		t.Errorf("expected 3 orders and 1 eviction, got %d and %d", stats.TotalOrders, stats.Evictions)
+	}
+	// the secondary indexes forget evicted orders
+	if got := len(c.FindByCustomer("customer")); got != 3 {
+		t.Errorf("expected 3 orders by customer, got %d", got)
+	}
+}
+
+func TestCacheMaxBytes(t *testing.T) {
+	size := approxOrderSize(testOrder("a"))
+	c := newTestCache(t, config.CacheConfig{Policy: PolicyLFU, MaxBytes: 2*size + size/2})
+	for _, uid := range []string{"a", "b", "c"} {
+		c.Set(uid, testOrder(uid))
+	}
+
+	stats := c.GetStats()
+	if stats.TotalOrders != 2 || stats.ApproxBytes != 2*size {
+		t.Fatalf("expected 2 orders of %d bytes, got %d orders and %d bytes", size, stats.TotalOrders, stats.ApproxBytes)
+	}
+	if _, ok := c.Peek("a"); ok {
+		t.Error("expected the oldest order to be evicted")
+	}
+}
+
+func TestCacheKeepsOneOrderOverMaxBytes(t *testing.T) {
+	c := newTestCache(t, config.CacheConfig{Policy: PolicyLRU, MaxBytes: 1})
+	c.Set("a", testOrder("a"))
+	if _, ok := c.Peek("a"); !ok {
+		t.Fatal("expected a single order larger than the limit to stay cached")
+	}
+}
+
+func TestCacheWithoutPolicyIsUnbounded(t *testing.T) {
+	c := newTestCache(t, config.CacheConfig{Policy: PolicyNone, MaxEntries: 1, MaxBytes: 1})
+	for i := 0; i < 10; i++ {
+		uid := fmt.Sprintf("order-%d", i)
+		c.Set(uid, testOrder(uid))
+	}
+	if got := c.GetStats().TotalOrders; got != 10 {
+		t.Fatalf("expected limits to be ignored without a policy, got %d orders", got)
+	}
+	if c.Bounded() {
+		t.Error("expected a cache without policy and ttl not to be bounded")
+	}
+}
+
+func TestShardedCacheSplitsLimits(t *testing.T) {
+	c := newTestCache(t, config.CacheConfig{Shards: 4, Policy: PolicyLRU, MaxEntries: 10, MaxBytes: 1000})
+	sharded := c.(*shardedCache)
+	for _, s := range sharded.shards {
+		// limits are rounded up so that the shards hold at least the total
+		if s.maxEntries != 3 || s.maxBytes != 250 {
+			t.Fatalf("expected shard limits of 3 orders and 250 bytes, got %d and %d", s.maxEntries, s.maxBytes)
+		}
+	}
+
+	c = newTestCache(t, config.CacheConfig{Shards: 4, Policy: PolicyLRU, MaxEntries: 10})
+	sharded = c.(*shardedCache)
+	for i := 0; i < 100; i++ {
+		uid := fmt.Sprintf("order-%d", i)
+		c.Set(uid, testOrder(uid))
+	}
+	for i, s := range sharded.shards {
+		if got := s.GetStats().TotalOrders; got > 3 {
+			t.Errorf("shard %d holds %d orders, limit 3", i, got)
+		}
+	}
+	stats := c.GetStats()
+	if stats.TotalOrders > 12 || stats.TotalOrders+int(stats.Evictions) != 100 {
+		t.Errorf("expected at most 12 orders and the rest evicted, got %d orders and %d evictions", stats.TotalOrders, stats.Evictions)
+	}
+}
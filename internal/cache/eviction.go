@@ -0,0 +1,163 @@
+package cache
+
+import (
+	"container/heap"
+	"container/list"
+	"fmt"
+)
+
+const (
+	PolicyNone = "none"
+	PolicyLRU  = "lru"
+	PolicyLFU  = "lfu"
+)
+
+// evictionPolicy decides which entry a bounded cache drops when it is full.
+// Implementations are not safe for concurrent use.
+type evictionPolicy interface {
+	add(key string)
+	touch(key string)
+	remove(key string)
+	victim() (string, bool)
+}
+
+type lruPolicy struct {
+	order    *list.List
+	elements map[string]*list.Element
+}
+
+func newLRUPolicy() *lruPolicy {
+	return &lruPolicy{
+		order:    list.New(),
+		elements: make(map[string]*list.Element),
+	}
+}
+
+func (p *lruPolicy) add(key string) {
+	if e, ok := p.elements[key]; ok {
+		p.order.MoveToFront(e)
+		return
+	}
+	p.elements[key] = p.order.PushFront(key)
+}
+
+func (p *lruPolicy) touch(key string) {
+	if e, ok := p.elements[key]; ok {
+		p.order.MoveToFront(e)
+	}
+}
+
+func (p *lruPolicy) remove(key string) {
+	if e, ok := p.elements[key]; ok {
+		p.order.Remove(e)
+		delete(p.elements, key)
+	}
+}
+
+func (p *lruPolicy) victim() (string, bool) {
+	e := p.order.Back()
+	if e == nil {
+		return "", false
+	}
+	return e.Value.(string), true
+}
+
+// lfuPolicy evicts the least frequently used key, breaking ties by the
+// least recent access.
+type lfuPolicy struct {
+	entries lfuHeap
+	items   map[string]*lfuEntry
+	clock   uint64
+}
+
+type lfuEntry struct {
+	key        string
+	frequency  uint64
+	lastAccess uint64
+	index      int
+}
+
+func newLFUPolicy() *lfuPolicy {
+	return &lfuPolicy{items: make(map[string]*lfuEntry)}
+}
+
+func (p *lfuPolicy) add(key string) {
+	if _, ok := p.items[key]; ok {
+		p.touch(key)
+		return
+	}
+	p.clock++
+	e := &lfuEntry{key: key, frequency: 1, lastAccess: p.clock}
+	p.items[key] = e
+	heap.Push(&p.entries, e)
+}
+
+func (p *lfuPolicy) touch(key string) {
+	e, ok := p.items[key]
+	if !ok {
+		return
+	}
+	p.clock++
+	e.frequency++
+	e.lastAccess = p.clock
+	heap.Fix(&p.entries, e.index)
+}
+
+func (p *lfuPolicy) remove(key string) {
+	e, ok := p.items[key]
+	if !ok {
+		return
+	}
+	heap.Remove(&p.entries, e.index)
+	delete(p.items, key)
+}
+
+func (p *lfuPolicy) victim() (string, bool) {
+	if len(p.entries) == 0 {
+		return "", false
+	}
+	return p.entries[0].key, true
+}
+
+type lfuHeap []*lfuEntry
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].frequency != h[j].frequency {
+		return h[i].frequency < h[j].frequency
+	}
+	return h[i].lastAccess < h[j].lastAccess
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x any) {
+	e := x.(*lfuEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *lfuHeap) Pop() any {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return e
+}
+
+func newEvictionPolicy(name string) (evictionPolicy, error) {
+	switch name {
+	case PolicyLRU:
+		return newLRUPolicy(), nil
+	case PolicyLFU:
+		return newLFUPolicy(), nil
+	default:
+		return nil, fmt.Errorf("unknown cache eviction policy: %q", name)
+	}
+}
@@ -0,0 +1,59 @@
+package cache
+
+import "testing"
+
+// evictAll drains p and returns the keys in eviction order.
+func evictAll(p evictionPolicy) []string {
+	var keys []string
+	for {
+		key, ok := p.victim()
+		if !ok {
+			return keys
+		}
+		keys = append(keys, key)
+		p.remove(key)
+	}
+}
+
+func TestEvictionOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy evictionPolicy
+		want   []string
+	}{
+		// b was never used again, d was re-added last
+		{name: "lru", policy: newLRUPolicy(), want: []string{"b", "c", "a", "d"}},
+		// a has 3 uses, c 2; b and d 1 each, b used less recently
+		{name: "lfu", policy: newLFUPolicy(), want: []string{"b", "d", "c", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.policy
+			for _, key := range []string{"a", "b", "c", "d"} {
+				p.add(key)
+			}
+			p.touch("a")
+			p.touch("missing")
+			p.add("c")
+			p.touch("a")
+			p.remove("d")
+			p.add("d")
+
+			got := evictAll(p)
+			if len(got) != len(tt.want) {
+				t.Fatalf("evicted %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("evicted %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewEvictionPolicyRejectsUnknownNames(t *testing.T) {
+	if _, err := newEvictionPolicy("fifo"); err == nil {
+		t.Fatal("expected an error for an unknown policy")
+	}
+}
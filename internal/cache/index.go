@@ -0,0 +1,28 @@
+package cache
+
+// secondaryIndex maps a field value, such as a track number, to the UIDs of
+// the cached orders that have it.
+type secondaryIndex map[string]map[string]struct{}
+
+func (idx secondaryIndex) add(key, orderUID string) {
+	if key == "" {
+		return
+	}
+	uids, ok := idx[key]
+	if !ok {
+		uids = make(map[string]struct{}, 1)
+		idx[key] = uids
+	}
+	uids[orderUID] = struct{}{}
+}
+
+func (idx secondaryIndex) remove(key, orderUID string) {
+	uids, ok := idx[key]
+	if !ok {
+		return
+	}
+	delete(uids, orderUID)
+	if len(uids) == 0 {
+		delete(idx, key)
+	}
+}
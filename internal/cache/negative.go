@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// negativeCacheLimit caps memory use when many distinct unknown UIDs are
+// probed within one ttl.
+const negativeCacheLimit = 100000
+
+// NegativeCache remembers order UIDs that were not found in the database,
+// so that repeated lookups of unknown UIDs do not reach Postgres. A zero ttl
+// disables it.
+type NegativeCache struct {
+	mu      sync.RWMutex
+	entries map[string]time.Time
+	ttl     time.Duration
+	now     func() time.Time // replaced in tests
+}
+
+func NewNegativeCache(ttl time.Duration) *NegativeCache {
+	return &NegativeCache{
+		entries: make(map[string]time.Time),
+		ttl:     ttl,
+		now:     time.Now,
+	}
+}
+
+func (n *NegativeCache) Add(orderUID string) {
+	if n.ttl <= 0 {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.entries) >= negativeCacheLimit {
+		return
+	}
+	n.entries[orderUID] = n.now().Add(n.ttl)
+}
+
+func (n *NegativeCache) Contains(orderUID string) bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	expiresAt, ok := n.entries[orderUID]
+	return ok && n.now().Before(expiresAt)
+}
+
+func (n *NegativeCache) Remove(orderUID string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.entries, orderUID)
+}
+
+func (n *NegativeCache) Clear() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.entries = make(map[string]time.Time)
+}
+
+func (n *NegativeCache) RemoveExpired() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := n.now()
+	removed := 0
+	for uid, expiresAt := range n.entries {
+		if now.After(expiresAt) {
+			delete(n.entries, uid)
+			removed++
+		}
+	}
+	return removed
+}
+
+func (n *NegativeCache) Len() int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return len(n.entries)
+}
+
+func (n *NegativeCache) TTL() time.Duration {
+	return n.ttl
+}
@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"hash/fnv"
+
+	"github.com/yokitheyo/wb_level0/internal/models"
+)
+
+// shardedCache spreads orders over independent orderCache shards by a hash
+// of order_uid, so writes to one shard do not block readers of the others.
+// Size limits are divided evenly between shards.
+type shardedCache struct {
+	shards []*orderCache
+}
+
+func newShardedCache(shards []*orderCache) *shardedCache {
+	return &shardedCache{shards: shards}
+}
+
+func (c *shardedCache) shard(orderUID string) *orderCache {
+	h := fnv.New32a()
+	h.Write([]byte(orderUID))
+	return c.shards[h.Sum32()%uint32(len(c.shards))]
+}
+
+func (c *shardedCache) Set(orderUID string, order models.Order) {
+	c.shard(orderUID).Set(orderUID, order)
+}
+
+func (c *shardedCache) Get(orderUID string) (models.Order, bool) {
+	return c.shard(orderUID).Get(orderUID)
+}
+
+func (c *shardedCache) Peek(orderUID string) (models.Order, bool) {
+	return c.shard(orderUID).Peek(orderUID)
+}
+
+func (c *shardedCache) LoadFromDB(orders []models.Order) {
+	groups := make(map[*orderCache][]models.Order, len(c.shards))
+	for _, order := range orders {
+		s := c.shard(order.OrderUID)
+		groups[s] = append(groups[s], order)
+	}
+	for s, group := range groups {
+		s.LoadFromDB(group)
+	}
+}
+
+func (c *shardedCache) FindByTrackNumber(trackNumber string) []models.Order {
+	var orders []models.Order
+	for _, s := range c.shards {
+		orders = append(orders, s.FindByTrackNumber(trackNumber)...)
+	}
+	return orders
+}
+
+func (c *shardedCache) FindByCustomer(customerID string) []models.Order {
+	var orders []models.Order
+	for _, s := range c.shards {
+		orders = append(orders, s.FindByCustomer(customerID)...)
+	}
+	return orders
+}
+
+func (c *shardedCache) Bounded() bool {
+	return c.shards[0].Bounded()
+}
+
+func (c *shardedCache) Delete(orderUID string) bool {
+	return c.shard(orderUID).Delete(orderUID)
+}
+
+func (c *shardedCache) DeleteByPrefix(prefix string) int {
+	removed := 0
+	for _, s := range c.shards {
+		removed += s.DeleteByPrefix(prefix)
+	}
+	return removed
+}
+
+func (c *shardedCache) Flush() int {
+	removed := 0
+	for _, s := range c.shards {
+		removed += s.Flush()
+	}
+	return removed
+}
+
+func (c *shardedCache) RemoveExpired() int {
+	removed := 0
+	for _, s := range c.shards {
+		removed += s.RemoveExpired()
+	}
+	return removed
+}
+
+func (c *shardedCache) Range(fn func(order models.Order) bool) {
+	stopped := false
+	for _, s := range c.shards {
+		s.Range(func(order models.Order) bool {
+			stopped = !fn(order)
+			return !stopped
+		})
+		if stopped {
+			return
+		}
+	}
+}
+
+// ListUIDs merges the pages of every shard, each already sorted.
+func (c *shardedCache) ListUIDs(after, prefix string, limit int) []string {
+	if limit <= 0 {
+		return nil
+	}
+
+	pages := make([][]string, len(c.shards))
+	for i, s := range c.shards {
+		pages[i] = s.ListUIDs(after, prefix, limit)
+	}
+	return mergeUIDs(pages, limit)
+}
+
+func (c *shardedCache) GetStats() CacheStats {
+	var stats CacheStats
+	for i, s := range c.shards {
+		shardStats := s.GetStats()
+		if i == 0 {
+			stats.TTL = shardStats.TTL
+		}
+		stats.TotalOrders += shardStats.TotalOrders
+		stats.Hits += shardStats.Hits
+		stats.Misses += shardStats.Misses
+		stats.Evictions += shardStats.Evictions
+		stats.Expired += shardStats.Expired
+		stats.ApproxBytes += shardStats.ApproxBytes
+		if shardStats.LastUpdated.After(stats.LastUpdated) {
+			stats.LastUpdated = shardStats.LastUpdated
+		}
+	}
+	stats.updateHitRatio()
+	return stats
+}
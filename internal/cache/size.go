@@ -0,0 +1,30 @@
+package cache
+
+import (
+	"unsafe"
+
+	"github.com/yokitheyo/wb_level0/internal/models"
+)
+
+// approxOrderSize estimates the memory held by an order: the structs
+// themselves plus the bytes of every string they reference.
+func approxOrderSize(order models.Order) int64 {
+	size := int64(unsafe.Sizeof(order)) +
+		int64(len(order.OrderUID)+len(order.TrackNumber)+len(order.Entry)+len(order.Locale)+
+			len(order.InternalSignature)+len(order.CustomerID)+len(order.DeliveryService)+
+			len(order.ShardKey)+len(order.OofShard))
+
+	d := order.Delivery
+	size += int64(len(d.Name) + len(d.Phone) + len(d.Zip) + len(d.City) + len(d.Address) + len(d.Region) + len(d.Email))
+
+	p := order.Payment
+	size += int64(len(p.Transaction) + len(p.RequestID) + len(p.Currency) + len(p.Provider) + len(p.Bank))
+
+	for _, item := range order.Items {
+		size += int64(unsafe.Sizeof(item)) +
+			int64(len(item.TrackNumber)+len(item.RID)+len(item.Name)+len(item.Size)+len(item.Brand))
+	}
+
+	// the map key duplicates order_uid
+	return size + int64(len(order.OrderUID))
+}
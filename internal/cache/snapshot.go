@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/yokitheyo/wb_level0/internal/models"
+)
+
+const snapshotFormatVersion = 1
+
+// A snapshot file is a gob stream of a snapshotHeader followed by one
+// snapshotRecord per order and a final record carrying the trailer.
+type snapshotHeader struct {
+	FormatVersion int
+	CreatedAt     time.Time
+}
+
+type snapshotRecord struct {
+	Order   *models.Order
+	Trailer *snapshotTrailer
+}
+
+type snapshotTrailer struct {
+	Orders    int
+	HighWater time.Time
+}
+
+type SnapshotInfo struct {
+	CreatedAt time.Time
+	Orders    int
+	// HighWater is the latest updated_at among the saved orders; orders
+	// written after it are not in the snapshot.
+	HighWater time.Time
+}
+
+// WriteSnapshot streams every order held by c to path. The file is written
+// next to path and renamed into place, so a crash never leaves a partial
+// snapshot behind.
+func WriteSnapshot(path string, c OrderCache) (SnapshotInfo, error) {
+	info := SnapshotInfo{CreatedAt: time.Now().UTC()}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return info, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return info, fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	w := bufio.NewWriter(tmp)
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(snapshotHeader{FormatVersion: snapshotFormatVersion, CreatedAt: info.CreatedAt}); err != nil {
+		return info, fmt.Errorf("failed to write snapshot header: %w", err)
+	}
+
+	var encodeErr error
+	c.Range(func(order models.Order) bool {
+		if encodeErr = enc.Encode(snapshotRecord{Order: &order}); encodeErr != nil {
+			return false
+		}
+		info.Orders++
+		if mark := highWater(order); mark.After(info.HighWater) {
+			info.HighWater = mark
+		}
+		return true
+	})
+	if encodeErr != nil {
+		return info, fmt.Errorf("failed to write snapshot order: %w", encodeErr)
+	}
+
+	trailer := snapshotTrailer{Orders: info.Orders, HighWater: info.HighWater}
+	if err := enc.Encode(snapshotRecord{Trailer: &trailer}); err != nil {
+		return info, fmt.Errorf("failed to write snapshot trailer: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		return info, fmt.Errorf("failed to flush snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return info, fmt.Errorf("failed to sync snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return info, fmt.Errorf("failed to close snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return info, fmt.Errorf("failed to replace snapshot: %w", err)
+	}
+	return info, nil
+}
+
+// LoadSnapshot reads a snapshot written by WriteSnapshot into c. It returns
+// an error wrapping os.ErrNotExist if there is no snapshot at path.
+func LoadSnapshot(path string, c OrderCache) (SnapshotInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return SnapshotInfo{}, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer f.Close()
+
+	dec := gob.NewDecoder(bufio.NewReader(f))
+	var header snapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return SnapshotInfo{}, fmt.Errorf("failed to read snapshot header: %w", err)
+	}
+	if header.FormatVersion != snapshotFormatVersion {
+		return SnapshotInfo{}, fmt.Errorf("unsupported snapshot format version %d", header.FormatVersion)
+	}
+
+	const batchSize = 1000
+	batch := make([]models.Order, 0, batchSize)
+	loaded := 0
+	for {
+		var record snapshotRecord
+		if err := dec.Decode(&record); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return SnapshotInfo{}, fmt.Errorf("failed to read snapshot record: %w", err)
+		}
+
+		if record.Trailer != nil {
+			c.LoadFromDB(batch)
+			loaded += len(batch)
+			if loaded != record.Trailer.Orders {
+				return SnapshotInfo{}, fmt.Errorf("snapshot is corrupted: expected %d orders, read %d", record.Trailer.Orders, loaded)
+			}
+			return SnapshotInfo{
+				CreatedAt: header.CreatedAt,
+				Orders:    loaded,
+				HighWater: record.Trailer.HighWater,
+			}, nil
+		}
+
+		if record.Order != nil {
+			batch = append(batch, *record.Order)
+		}
+		if len(batch) == batchSize {
+			c.LoadFromDB(batch)
+			loaded += len(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// highWater is the time the order was last written to the database. Orders
+// read from a database that predates updated_at fall back to date_created.
+func highWater(order models.Order) time.Time {
+	if !order.UpdatedAt.IsZero() {
+		return order.UpdatedAt
+	}
+	return order.DateCreated
+}
@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yokitheyo/wb_level0/internal/models"
+	"go.uber.org/zap"
+)
+
+func snapshotOrders(n int) []models.Order {
+	base := time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC)
+	orders := make([]models.Order, n)
+	for i := range orders {
+		orders[i] = testOrder(fmt.Sprintf("order-%04d", i))
+		orders[i].Version = i%3 + 1
+		orders[i].UpdatedAt = base.Add(time.Duration(i) * time.Second)
+	}
+	return orders
+}
+
+func writeTestSnapshot(t *testing.T, orders []models.Order) string {
+	t.Helper()
+	source := NewOrderCache(zap.NewNop())
+	source.LoadFromDB(orders)
+	path := filepath.Join(t.TempDir(), "data", "cache.snapshot")
+	if _, err := WriteSnapshot(path, source); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	// more than one load batch
+	orders := snapshotOrders(2500)
+	// an order saved before updated_at existed counts by date_created
+	orders[0].UpdatedAt = time.Time{}
+	orders[0].DateCreated = orders[len(orders)-1].UpdatedAt.Add(time.Hour)
+
+	source := NewOrderCache(zap.NewNop())
+	source.LoadFromDB(orders)
+	path := filepath.Join(t.TempDir(), "data", "cache.snapshot")
+	written, err := WriteSnapshot(path, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := NewOrderCache(zap.NewNop())
+	loaded, err := LoadSnapshot(path, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Orders != len(orders) || written.Orders != len(orders) {
+		t.Fatalf("expected %d orders written and loaded, got %d and %d", len(orders), written.Orders, loaded.Orders)
+	}
+	if !loaded.HighWater.Equal(orders[0].DateCreated) || !written.HighWater.Equal(loaded.HighWater) {
+		t.Errorf("expected high-water mark %v, got %v written and %v loaded", orders[0].DateCreated, written.HighWater, loaded.HighWater)
+	}
+	if !loaded.CreatedAt.Equal(written.CreatedAt) {
+		t.Errorf("expected created at %v, got %v", written.CreatedAt, loaded.CreatedAt)
+	}
+	for _, order := range orders {
+		got, ok := target.Peek(order.OrderUID)
+		if !ok || got.Version != order.Version || !got.UpdatedAt.Equal(order.UpdatedAt) {
+			t.Fatalf("order %s: got %+v, want version %d", order.OrderUID, got, order.Version)
+		}
+	}
+
+	// no temporary files are left next to the snapshot
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("expected only the snapshot in its directory, got %d files", len(entries))
+	}
+}
+
+func TestLoadSnapshotKeepsNewerCachedOrders(t *testing.T) {
+	orders := snapshotOrders(3)
+	path := writeTestSnapshot(t, orders)
+
+	newer := orders[1]
+	newer.Version += 10
+	target := NewOrderCache(zap.NewNop())
+	target.Set(newer.OrderUID, newer)
+	if _, err := LoadSnapshot(path, target); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := target.Peek(newer.OrderUID); got.Version != newer.Version {
+		t.Fatalf("expected the newer cached version %d to be kept, got %d", newer.Version, got.Version)
+	}
+}
+
+func TestLoadSnapshotMissing(t *testing.T) {
+	_, err := LoadSnapshot(filepath.Join(t.TempDir(), "none"), NewOrderCache(zap.NewNop()))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected os.ErrNotExist, got %v", err)
+	}
+}
+
+func TestLoadSnapshotTruncated(t *testing.T) {
+	path := writeTestSnapshot(t, snapshotOrders(10))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// cutting anywhere after the header loses at least the trailer
+	for _, cut := range []int{1, 10, len(data) / 2} {
+		if err := os.WriteFile(path, data[:len(data)-cut], 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadSnapshot(path, NewOrderCache(zap.NewNop())); err == nil {
+			t.Errorf("expected an error for a snapshot cut by %d bytes", cut)
+		}
+	}
+}
+
+// writeRawSnapshot writes a snapshot by hand, so that it can be inconsistent.
+func writeRawSnapshot(t *testing.T, header snapshotHeader, records ...snapshotRecord) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	enc := gob.NewEncoder(f)
+	if err := enc.Encode(header); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func TestLoadSnapshotCorruptedTrailer(t *testing.T) {
+	order := testOrder("a")
+	path := writeRawSnapshot(t,
+		snapshotHeader{FormatVersion: snapshotFormatVersion},
+		snapshotRecord{Order: &order},
+		snapshotRecord{Trailer: &snapshotTrailer{Orders: 2}},
+	)
+	_, err := LoadSnapshot(path, NewOrderCache(zap.NewNop()))
+	if err == nil || !strings.Contains(err.Error(), "corrupted") {
+		t.Fatalf("expected a corrupted snapshot error, got %v", err)
+	}
+}
+
+func TestLoadSnapshotUnsupportedVersion(t *testing.T) {
+	path := writeRawSnapshot(t, snapshotHeader{FormatVersion: snapshotFormatVersion + 1})
+	if _, err := LoadSnapshot(path, NewOrderCache(zap.NewNop())); err == nil {
+		t.Fatal("expected an error for an unknown format version")
+	}
+}
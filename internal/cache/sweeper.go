@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RunSweeper removes expired entries from c and negative every interval
+// until ctx is cancelled.
+func RunSweeper(ctx context.Context, c OrderCache, negative *NegativeCache, interval time.Duration, logger *zap.Logger) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired := c.RemoveExpired()
+			missing := negative.RemoveExpired()
+			if expired > 0 || missing > 0 {
+				logger.Debug("expired cache entries removed",
+					zap.Int("orders", expired),
+					zap.Int("negative", missing),
+				)
+			}
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yokitheyo/wb_level0/internal/config"
+	"go.uber.org/zap"
+)
+
+// fakeClock is a clock that only moves when advanced.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newClockedCache builds a cache whose shards all run on clock.
+func newClockedCache(t *testing.T, cfg config.CacheConfig, clock *fakeClock) OrderCache {
+	t.Helper()
+	c := newTestCache(t, cfg)
+	switch c := c.(type) {
+	case *orderCache:
+		c.now = clock.Now
+	case *shardedCache:
+		for _, s := range c.shards {
+			s.now = clock.Now
+		}
+	}
+	return c
+}
+
+func TestCacheTTLExpiry(t *testing.T) {
+	for _, shards := range []int{1, 4} {
+		clock := newFakeClock()
+		c := newClockedCache(t, config.CacheConfig{Shards: shards, TTL: time.Minute}, clock)
+		c.Set("a", testOrder("a"))
+
+		clock.advance(30 * time.Second)
+		c.Set("b", testOrder("b"))
+		if _, ok := c.Get("a"); !ok {
+			t.Fatalf("shards=%d: expected a to be cached before its ttl", shards)
+		}
+
+		clock.advance(31 * time.Second)
+		if _, ok := c.Get("a"); ok {
+			t.Fatalf("shards=%d: expected a to expire after its ttl", shards)
+		}
+		if _, ok := c.Peek("a"); ok {
+			t.Fatalf("shards=%d: expected Peek to skip the expired order", shards)
+		}
+		if got := c.FindByCustomer("customer"); len(got) != 1 || got[0].OrderUID != "b" {
+			t.Fatalf("shards=%d: expected only b by customer, got %v", shards, got)
+		}
+		if got := c.ListUIDs("", "", 10); len(got) != 1 || got[0] != "b" {
+			t.Fatalf("shards=%d: expected only b listed, got %v", shards, got)
+		}
+
+		// expired entries stay counted until they are swept
+		if got := c.GetStats().TotalOrders; got != 2 {
+			t.Fatalf("shards=%d: expected 2 entries before sweeping, got %d", shards, got)
+		}
+		if removed := c.RemoveExpired(); removed != 1 {
+			t.Fatalf("shards=%d: expected 1 expired entry removed, got %d", shards, removed)
+		}
+
+		stats := c.GetStats()
+		if stats.TotalOrders != 1 || stats.Expired != 1 {
+			t.Errorf("shards=%d: expected 1 order and 1 expired, got %d and %d", shards, stats.TotalOrders, stats.Expired)
+		}
+		if stats.Hits != 1 || stats.Misses != 1 || stats.HitRatio != 0.5 {
+			t.Errorf("shards=%d: expected 1 hit, 1 miss and ratio 0.5, got %d, %d and %v", shards, stats.Hits, stats.Misses, stats.HitRatio)
+		}
+		if stats.TTL != "1m0s" {
+			t.Errorf("shards=%d: expected ttl 1m0s, got %s", shards, stats.TTL)
+		}
+	}
+}
+
+func TestCacheSetRenewsTTL(t *testing.T) {
+	clock := newFakeClock()
+	c := newClockedCache(t, config.CacheConfig{TTL: time.Minute}, clock)
+	c.Set("a", testOrder("a"))
+	clock.advance(50 * time.Second)
+	c.Set("a", testOrder("a"))
+	clock.advance(50 * time.Second)
+
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("expected Set to restart the ttl")
+	}
+}
+
+func TestCacheWithoutTTLNeverExpires(t *testing.T) {
+	clock := newFakeClock()
+	c := newClockedCache(t, config.CacheConfig{}, clock)
+	c.Set("a", testOrder("a"))
+	clock.advance(365 * 24 * time.Hour)
+
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("expected the order to stay cached without a ttl")
+	}
+	if removed := c.RemoveExpired(); removed != 0 {
+		t.Fatalf("expected nothing to expire, got %d", removed)
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	clock := newFakeClock()
+	n := NewNegativeCache(time.Minute)
+	n.now = clock.Now
+
+	n.Add("missing")
+	if !n.Contains("missing") || n.Contains("other") {
+		t.Fatal("expected only the added UID to be remembered")
+	}
+
+	n.Remove("missing")
+	if n.Contains("missing") {
+		t.Fatal("expected Remove to forget the UID")
+	}
+
+	n.Add("missing")
+	clock.advance(61 * time.Second)
+	if n.Contains("missing") {
+		t.Fatal("expected the UID to be forgotten after the ttl")
+	}
+	if n.Len() != 1 {
+		t.Fatalf("expected the expired entry to stay until swept, got %d entries", n.Len())
+	}
+	if removed := n.RemoveExpired(); removed != 1 || n.Len() != 0 {
+		t.Fatalf("expected 1 expired entry removed, got %d and %d left", removed, n.Len())
+	}
+}
+
+func TestNegativeCacheLimit(t *testing.T) {
+	n := NewNegativeCache(time.Minute)
+	for i := 0; i < negativeCacheLimit+10; i++ {
+		n.Add("uid-" + strconv.Itoa(i))
+	}
+	if got := n.Len(); got != negativeCacheLimit {
+		t.Fatalf("expected at most %d entries, got %d", negativeCacheLimit, got)
+	}
+
+	n.Clear()
+	if n.Len() != 0 {
+		t.Fatal("expected Clear to empty the cache")
+	}
+}
+
+func TestNegativeCacheDisabled(t *testing.T) {
+	n := NewNegativeCache(0)
+	n.Add("missing")
+	if n.Contains("missing") || n.Len() != 0 {
+		t.Fatal("expected a zero ttl to disable the negative cache")
+	}
+}
+
+func TestRunSweeper(t *testing.T) {
+	clock := newFakeClock()
+	c := newClockedCache(t, config.CacheConfig{TTL: time.Minute}, clock)
+	n := NewNegativeCache(time.Minute)
+	n.now = clock.Now
+	c.Set("a", testOrder("a"))
+	n.Add("missing")
+	clock.advance(2 * time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		RunSweeper(ctx, c, n, time.Millisecond, zap.NewNop())
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for c.GetStats().TotalOrders != 0 || n.Len() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the sweeper")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+}
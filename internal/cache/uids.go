@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// uidHeap is a max-heap of order UIDs.
+type uidHeap []string
+
+func (h uidHeap) Len() int            { return len(h) }
+func (h uidHeap) Less(i, j int) bool  { return h[i] > h[j] }
+func (h uidHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *uidHeap) Push(x interface{}) { *h = append(*h, x.(string)) }
+func (h *uidHeap) Pop() interface{} {
+	old := *h
+	uid := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return uid
+}
+
+// smallestUIDs keeps the limit smallest UIDs offered to it, so that a page
+// of UIDs can be taken from a map without copying and sorting all its keys.
+type smallestUIDs struct {
+	heap  uidHeap
+	limit int
+}
+
+func newSmallestUIDs(limit int) *smallestUIDs {
+	return &smallestUIDs{heap: make(uidHeap, 0, limit), limit: limit}
+}
+
+func (s *smallestUIDs) offer(uid string) {
+	// the heap is only needed once it is full, and filling it without
+	// Push avoids boxing every UID
+	if len(s.heap) < s.limit {
+		s.heap = append(s.heap, uid)
+		if len(s.heap) == s.limit {
+			heap.Init(&s.heap)
+		}
+		return
+	}
+	if uid < s.heap[0] {
+		s.heap[0] = uid
+		heap.Fix(&s.heap, 0)
+	}
+}
+
+// sorted returns the kept UIDs in ascending order.
+func (s *smallestUIDs) sorted() []string {
+	uids := []string(s.heap)
+	sort.Strings(uids)
+	return uids
+}
+
+// mergeUIDs merges ascending lists of distinct UIDs into one ascending list
+// of at most limit UIDs.
+func mergeUIDs(lists [][]string, limit int) []string {
+	uids := make([]string, 0, limit)
+	for len(uids) < limit {
+		next := -1
+		for i, list := range lists {
+			if len(list) > 0 && (next < 0 || list[0] < lists[next][0]) {
+				next = i
+			}
+		}
+		if next < 0 {
+			break
+		}
+		uids = append(uids, lists[next][0])
+		lists[next] = lists[next][1:]
+	}
+	return uids
+}
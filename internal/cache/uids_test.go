@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/yokitheyo/wb_level0/internal/config"
+)
+
+func TestListUIDsPages(t *testing.T) {
+	for _, shards := range []int{1, 4} {
+		t.Run(fmt.Sprintf("shards-%d", shards), func(t *testing.T) {
+			c := newTestCache(t, config.CacheConfig{Shards: shards})
+			var want []string
+			// inserted out of order, half of them under the listed prefix
+			for i := 249; i >= 0; i-- {
+				prefix := "other-"
+				if i%2 == 0 {
+					prefix = "order-"
+				}
+				uid := fmt.Sprintf("%s%03d", prefix, i)
+				c.Set(uid, testOrder(uid))
+				if prefix == "order-" {
+					want = append(want, uid)
+				}
+			}
+			sort.Strings(want)
+
+			var got []string
+			after := ""
+			for {
+				page := c.ListUIDs(after, "order-", 7)
+				if len(page) > 7 {
+					t.Fatalf("page of %d UIDs, want at most 7", len(page))
+				}
+				if len(page) == 0 {
+					break
+				}
+				got = append(got, page...)
+				after = page[len(page)-1]
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("listed %d UIDs, want %d:\n%v", len(got), len(want), strings.Join(got, " "))
+			}
+
+			if page := c.ListUIDs("", "", 0); len(page) != 0 {
+				t.Errorf("ListUIDs() with limit 0 = %v, want none", page)
+			}
+		})
+	}
+}
+
+func TestMergeUIDs(t *testing.T) {
+	lists := [][]string{{"a", "d", "g"}, {}, {"b", "c"}, {"e"}}
+	if got, want := mergeUIDs(lists, 4), []string{"a", "b", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeUIDs() = %v, want %v", got, want)
+	}
+	if got, want := mergeUIDs([][]string{{"a"}, {"b"}}, 10), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeUIDs() = %v, want %v", got, want)
+	}
+}
@@ -1,11 +1,21 @@
 package config
 
-import "github.com/spf13/viper"
+import (
+	"time"
+
+	"github.com/spf13/viper"
+)
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Kafka    KafkaConfig
+	Server      ServerConfig
+	Database    DatabaseConfig
+	Kafka       KafkaConfig
+	Cache       CacheConfig
+	Admin       AdminConfig
+	Verifier    VerifierConfig
+	Validation  ValidationConfig
+	Decoding    DecodingConfig
+	Idempotency IdempotencyConfig
 }
 
 type ServerConfig struct {
@@ -22,14 +32,112 @@ type DatabaseConfig struct {
 }
 
 type KafkaConfig struct {
-	Brokers []string
-	Topic   string
-	GroupID string
+	Brokers         []string
+	Topic           string
+	GroupID         string
+	DLQTopic        string
+	Workers         int
+	WorkerQueueSize int
+	BatchSize       int
+	BatchTimeout    time.Duration
+	Retry           RetryConfig
+	CircuitBreaker  CircuitBreakerConfig
+}
+
+type RetryConfig struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Jitter         float64
+}
+
+type CircuitBreakerConfig struct {
+	FailureThreshold int
+	OpenTimeout      time.Duration
+}
+
+type CacheConfig struct {
+	BackgroundWarmup bool
+	Shards           int
+	Policy           string
+	MaxEntries       int
+	MaxBytes         int64
+	TTL              time.Duration
+	NegativeTTL      time.Duration
+	SweepInterval    time.Duration
+	SnapshotPath     string
+	SnapshotInterval time.Duration
+}
+
+// AdminConfig protects the /admin endpoints. An empty token disables them.
+type AdminConfig struct {
+	Token string
+}
+
+// VerifierConfig schedules the cache/database consistency check. A zero
+// interval disables the background job.
+type VerifierConfig struct {
+	Interval     time.Duration
+	Repair       bool
+	CheckMissing bool
+}
+
+// ValidationConfig sets the mode of each order consistency rule: "off",
+// "warn" (accept and report) or "reject". RulesFile replaces the built-in
+// field rules and is reloaded every ReloadInterval when it changes.
+type ValidationConfig struct {
+	GoodsTotal      string
+	ItemTotalPrice  string
+	PaymentAmount   string
+	ItemTrackNumber string
+	RulesFile       string
+	ReloadInterval  time.Duration
+}
+
+// DecodingConfig controls how order payloads are decoded. Strict checks the
+// JSON against the order model first; UnknownFields is "off", "warn" or
+// "reject", and a zero limit is not enforced.
+type DecodingConfig struct {
+	Strict          bool
+	UnknownFields   string
+	MaxItems        int
+	MaxStringLength int
+}
+
+// IdempotencyConfig sets how long processed message keys are kept to detect
+// redelivered messages. Keys older than Retention are deleted every
+// CleanupInterval; a zero value of either disables the cleanup.
+type IdempotencyConfig struct {
+	Retention       time.Duration
+	CleanupInterval time.Duration
 }
 
 func LoadConfig(path string) (*Config, error) {
 	viper.SetConfigFile(path)
 	viper.AutomaticEnv()
+	if err := viper.BindEnv("admin.token", "ADMIN_TOKEN"); err != nil {
+		return nil, err
+	}
+
+	viper.SetDefault("cache.sweepinterval", time.Minute)
+	viper.SetDefault("cache.snapshotinterval", 5*time.Minute)
+	viper.SetDefault("validation.goodstotal", "warn")
+	viper.SetDefault("validation.itemtotalprice", "warn")
+	viper.SetDefault("validation.paymentamount", "warn")
+	viper.SetDefault("validation.itemtracknumber", "warn")
+	viper.SetDefault("validation.reloadinterval", 10*time.Second)
+	viper.SetDefault("decoding.unknownfields", "warn")
+	viper.SetDefault("idempotency.retention", 7*24*time.Hour)
+	viper.SetDefault("idempotency.cleanupinterval", time.Hour)
+	viper.SetDefault("kafka.workers", 1)
+	viper.SetDefault("kafka.workerqueuesize", 100)
+	viper.SetDefault("kafka.batchtimeout", 500*time.Millisecond)
+	viper.SetDefault("kafka.retry.maxattempts", 5)
+	viper.SetDefault("kafka.retry.initialbackoff", 200*time.Millisecond)
+	viper.SetDefault("kafka.retry.maxbackoff", 10*time.Second)
+	viper.SetDefault("kafka.retry.jitter", 0.2)
+	viper.SetDefault("kafka.circuitbreaker.failurethreshold", 5)
+	viper.SetDefault("kafka.circuitbreaker.opentimeout", 30*time.Second)
 
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, err
@@ -0,0 +1,85 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/yokitheyo/wb_level0/internal/models"
+)
+
+var csvHeader = []string{
+	"order_uid", "track_number", "entry", "locale", "internal_signature",
+	"customer_id", "delivery_service", "shardkey", "sm_id", "date_created", "oof_shard",
+	"version", "updated_at",
+	"delivery_name", "delivery_phone", "delivery_zip", "delivery_city",
+	"delivery_address", "delivery_region", "delivery_email",
+	"payment_transaction", "payment_request_id", "payment_currency", "payment_provider",
+	"payment_amount", "payment_dt", "payment_bank", "payment_delivery_cost",
+	"payment_goods_total", "payment_custom_fee",
+	"item_chrt_id", "item_track_number", "item_price", "item_rid", "item_name",
+	"item_sale", "item_size", "item_total_price", "item_nm_id", "item_brand", "item_status",
+}
+
+// csvWriter writes one row per item, repeating the order columns. An order
+// without items gets a single row with empty item columns.
+type csvWriter struct {
+	w   *csv.Writer
+	row []string
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w), row: make([]string, 0, len(csvHeader))}
+	if err := cw.w.Write(csvHeader); err != nil {
+		return nil, fmt.Errorf("failed to write csv header: %w", err)
+	}
+	return cw, nil
+}
+
+func (w *csvWriter) Write(order models.Order) error {
+	if len(order.Items) == 0 {
+		return w.writeRow(order, nil)
+	}
+	for i := range order.Items {
+		if err := w.writeRow(order, &order.Items[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *csvWriter) writeRow(order models.Order, item *models.Item) error {
+	d, p := order.Delivery, order.Payment
+	row := append(w.row[:0],
+		order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature,
+		order.CustomerID, order.DeliveryService, order.ShardKey, strconv.Itoa(order.SmID),
+		order.DateCreated.UTC().Format(time.RFC3339), order.OofShard,
+		strconv.Itoa(order.Version), order.UpdatedAt.UTC().Format(time.RFC3339Nano),
+		d.Name, d.Phone, d.Zip, d.City, d.Address, d.Region, d.Email,
+		p.Transaction, p.RequestID, p.Currency, p.Provider,
+		strconv.Itoa(p.Amount), strconv.FormatInt(p.PaymentDt, 10), p.Bank, strconv.Itoa(p.DeliveryCost),
+		strconv.Itoa(p.GoodsTotal), strconv.Itoa(p.CustomFee),
+	)
+	if item != nil {
+		row = append(row,
+			strconv.Itoa(item.ChrtID), item.TrackNumber, strconv.Itoa(item.Price), item.RID, item.Name,
+			strconv.Itoa(item.Sale), item.Size, strconv.Itoa(item.TotalPrice), strconv.Itoa(item.NmID),
+			item.Brand, strconv.Itoa(item.Status),
+		)
+	} else {
+		row = append(row, make([]string, len(csvHeader)-len(row))...)
+	}
+	w.row = row
+
+	if err := w.w.Write(row); err != nil {
+		return fmt.Errorf("failed to write csv row: %w", err)
+	}
+	return nil
+}
+
+func (w *csvWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
@@ -0,0 +1,31 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/yokitheyo/wb_level0/internal/models"
+)
+
+type ndjsonWriter struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func newNDJSONWriter(w io.Writer) *ndjsonWriter {
+	buf := bufio.NewWriter(w)
+	return &ndjsonWriter{buf: buf, enc: json.NewEncoder(buf)}
+}
+
+func (w *ndjsonWriter) Write(order models.Order) error {
+	if err := w.enc.Encode(order); err != nil {
+		return fmt.Errorf("failed to encode order: %w", err)
+	}
+	return nil
+}
+
+func (w *ndjsonWriter) Close() error {
+	return w.buf.Flush()
+}
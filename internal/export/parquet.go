@@ -0,0 +1,157 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/yokitheyo/wb_level0/internal/models"
+)
+
+// parquetRowGroupSize bounds how many orders are buffered before a row
+// group is written out.
+const parquetRowGroupSize = 10000
+
+// parquetOrder mirrors models.Order with items kept as a repeated group.
+type parquetOrder struct {
+	OrderUID          string          `parquet:"order_uid"`
+	TrackNumber       string          `parquet:"track_number"`
+	Entry             string          `parquet:"entry"`
+	Locale            string          `parquet:"locale"`
+	InternalSignature string          `parquet:"internal_signature"`
+	CustomerID        string          `parquet:"customer_id"`
+	DeliveryService   string          `parquet:"delivery_service"`
+	ShardKey          string          `parquet:"shardkey"`
+	SmID              int32           `parquet:"sm_id"`
+	DateCreated       time.Time       `parquet:"date_created,timestamp(microsecond)"`
+	OofShard          string          `parquet:"oof_shard"`
+	Version           int32           `parquet:"version"`
+	UpdatedAt         time.Time       `parquet:"updated_at,timestamp(microsecond)"`
+	Delivery          parquetDelivery `parquet:"delivery"`
+	Payment           parquetPayment  `parquet:"payment"`
+	Items             []parquetItem   `parquet:"items,list"`
+}
+
+type parquetDelivery struct {
+	Name    string `parquet:"name"`
+	Phone   string `parquet:"phone"`
+	Zip     string `parquet:"zip"`
+	City    string `parquet:"city"`
+	Address string `parquet:"address"`
+	Region  string `parquet:"region"`
+	Email   string `parquet:"email"`
+}
+
+type parquetPayment struct {
+	Transaction  string `parquet:"transaction"`
+	RequestID    string `parquet:"request_id"`
+	Currency     string `parquet:"currency"`
+	Provider     string `parquet:"provider"`
+	Amount       int64  `parquet:"amount"`
+	PaymentDt    int64  `parquet:"payment_dt"`
+	Bank         string `parquet:"bank"`
+	DeliveryCost int64  `parquet:"delivery_cost"`
+	GoodsTotal   int64  `parquet:"goods_total"`
+	CustomFee    int64  `parquet:"custom_fee"`
+}
+
+type parquetItem struct {
+	ChrtID      int64  `parquet:"chrt_id"`
+	TrackNumber string `parquet:"track_number"`
+	Price       int64  `parquet:"price"`
+	RID         string `parquet:"rid"`
+	Name        string `parquet:"name"`
+	Sale        int32  `parquet:"sale"`
+	Size        string `parquet:"size"`
+	TotalPrice  int64  `parquet:"total_price"`
+	NmID        int64  `parquet:"nm_id"`
+	Brand       string `parquet:"brand"`
+	Status      int32  `parquet:"status"`
+}
+
+type parquetWriter struct {
+	w   *parquet.GenericWriter[parquetOrder]
+	row [1]parquetOrder
+}
+
+func newParquetWriter(w io.Writer) *parquetWriter {
+	return &parquetWriter{
+		w: parquet.NewGenericWriter[parquetOrder](w,
+			parquet.Compression(&parquet.Zstd),
+			parquet.MaxRowsPerRowGroup(parquetRowGroupSize),
+		),
+	}
+}
+
+func (w *parquetWriter) Write(order models.Order) error {
+	w.row[0] = toParquetOrder(order)
+	if _, err := w.w.Write(w.row[:]); err != nil {
+		return fmt.Errorf("failed to write parquet row: %w", err)
+	}
+	return nil
+}
+
+func (w *parquetWriter) Close() error {
+	if err := w.w.Close(); err != nil {
+		return fmt.Errorf("failed to close parquet writer: %w", err)
+	}
+	return nil
+}
+
+func toParquetOrder(order models.Order) parquetOrder {
+	d, p := order.Delivery, order.Payment
+	row := parquetOrder{
+		OrderUID:          order.OrderUID,
+		TrackNumber:       order.TrackNumber,
+		Entry:             order.Entry,
+		Locale:            order.Locale,
+		InternalSignature: order.InternalSignature,
+		CustomerID:        order.CustomerID,
+		DeliveryService:   order.DeliveryService,
+		ShardKey:          order.ShardKey,
+		SmID:              int32(order.SmID),
+		DateCreated:       order.DateCreated.UTC(),
+		OofShard:          order.OofShard,
+		Version:           int32(order.Version),
+		UpdatedAt:         order.UpdatedAt.UTC(),
+		Delivery: parquetDelivery{
+			Name:    d.Name,
+			Phone:   d.Phone,
+			Zip:     d.Zip,
+			City:    d.City,
+			Address: d.Address,
+			Region:  d.Region,
+			Email:   d.Email,
+		},
+		Payment: parquetPayment{
+			Transaction:  p.Transaction,
+			RequestID:    p.RequestID,
+			Currency:     p.Currency,
+			Provider:     p.Provider,
+			Amount:       int64(p.Amount),
+			PaymentDt:    p.PaymentDt,
+			Bank:         p.Bank,
+			DeliveryCost: int64(p.DeliveryCost),
+			GoodsTotal:   int64(p.GoodsTotal),
+			CustomFee:    int64(p.CustomFee),
+		},
+		Items: make([]parquetItem, len(order.Items)),
+	}
+	for i, item := range order.Items {
+		row.Items[i] = parquetItem{
+			ChrtID:      int64(item.ChrtID),
+			TrackNumber: item.TrackNumber,
+			Price:       int64(item.Price),
+			RID:         item.RID,
+			Name:        item.Name,
+			Sale:        int32(item.Sale),
+			Size:        item.Size,
+			TotalPrice:  int64(item.TotalPrice),
+			NmID:        int64(item.NmID),
+			Brand:       item.Brand,
+			Status:      int32(item.Status),
+		}
+	}
+	return row
+}
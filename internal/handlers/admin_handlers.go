@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yokitheyo/wb_level0/internal/services"
+	"go.uber.org/zap"
+)
+
+type AdminHandler struct {
+	service services.OrderService
+	token   string
+	logger  *zap.Logger
+}
+
+func NewAdminHandler(service services.OrderService, token string, logger *zap.Logger) *AdminHandler {
+	return &AdminHandler{
+		service: service,
+		token:   token,
+		logger:  logger,
+	}
+}
+
+// authenticate accepts requests carrying "Authorization: Bearer <token>".
+func (h *AdminHandler) authenticate(c *gin.Context) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	c.Next()
+}
+
+func (h *AdminHandler) EvictOrder(c *gin.Context) {
+	orderUID := c.Param("order_uid")
+	evicted := h.service.EvictOrder(orderUID)
+	c.JSON(http.StatusOK, gin.H{
+		"order_uid": orderUID,
+		"evicted":   evicted,
+	})
+}
+
+func (h *AdminHandler) EvictOrdersByPrefix(c *gin.Context) {
+	prefix := c.Query("prefix")
+	if prefix == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "prefix is required, use DELETE /admin/cache to flush"})
+		return
+	}
+
+	evicted := h.service.EvictOrdersByPrefix(prefix)
+	c.JSON(http.StatusOK, gin.H{
+		"prefix":  prefix,
+		"evicted": evicted,
+	})
+}
+
+func (h *AdminHandler) FlushCache(c *gin.Context) {
+	flushed := h.service.FlushCache()
+	c.JSON(http.StatusOK, gin.H{"evicted": flushed})
+}
+
+func (h *AdminHandler) ReloadOrder(c *gin.Context) {
+	orderUID := c.Param("order_uid")
+	order, err := h.service.ReloadOrder(c, orderUID)
+	if err != nil {
+		h.logger.Error("failed to reload order", zap.Error(err), zap.String("order_uid", orderUID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reload order"})
+		return
+	}
+
+	if order == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+// RestoreCache starts a full cache restore in the background; its progress
+// is reported by GET /cache/warmup.
+func (h *AdminHandler) RestoreCache(c *gin.Context) {
+	if h.service.GetWarmupStatus().State == services.WarmupRunning {
+		c.JSON(http.StatusConflict, gin.H{"error": services.ErrRestoreInProgress.Error()})
+		return
+	}
+
+	ctx := context.WithoutCancel(c.Request.Context())
+	go func() {
+		if err := h.service.RestoreCache(ctx); err != nil {
+			if errors.Is(err, services.ErrRestoreInProgress) {
+				h.logger.Warn("cache restore skipped", zap.Error(err))
+				return
+			}
+			h.logger.Error("cache restore failed", zap.Error(err))
+		}
+	}()
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "restore started"})
+}
+
+// VerifyCache compares the cache with the database and returns the report.
+// ?repair=true fixes drifted entries and ?check_missing=true also looks for
+// stored orders that are not cached.
+func (h *AdminHandler) VerifyCache(c *gin.Context) {
+	var opts services.VerifyOptions
+	var err error
+	if opts.Repair, err = queryBool(c, "repair"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "repair must be a boolean"})
+		return
+	}
+	if opts.CheckMissing, err = queryBool(c, "check_missing"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "check_missing must be a boolean"})
+		return
+	}
+
+	report, err := h.service.VerifyCache(c, opts)
+	if errors.Is(err, services.ErrVerificationInProgress) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error("failed to verify cache", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, report)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func queryBool(c *gin.Context, key string) (bool, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(raw)
+}
+
+func (h *AdminHandler) RegisterRoutes(router *gin.Engine) {
+	admin := router.Group("/admin", h.authenticate)
+	admin.DELETE("/cache", h.FlushCache)
+	admin.DELETE("/cache/orders", h.EvictOrdersByPrefix)
+	admin.DELETE("/cache/orders/:order_uid", h.EvictOrder)
+	admin.POST("/cache/orders/:order_uid/reload", h.ReloadOrder)
+	admin.POST("/cache/restore", h.RestoreCache)
+	admin.POST("/cache/verify", h.VerifyCache)
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yokitheyo/wb_level0/internal/export"
+	"go.uber.org/zap"
+)
+
+const exportErrorTrailer = "X-Export-Error"
+
+// ExportOrders streams the orders matching the search filters as csv (one
+// row per item), ndjson or parquet. Once streaming has started a failure can
+// no longer change the status code, so it is reported in the X-Export-Error
+// trailer instead.
+func (h *OrderHandler) ExportOrders(c *gin.Context) {
+	format, err := export.ParseFormat(c.DefaultQuery("format", string(export.FormatCSV)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter, err := parseOrderFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", `attachment; filename="orders.`+string(format)+`"`)
+	c.Header("Trailer", exportErrorTrailer)
+	c.Status(http.StatusOK)
+
+	w, err := export.NewWriter(format, c.Writer)
+	if err == nil {
+		var written int
+		// a failed export is not flushed, so that nothing is sent if it
+		// failed before the first buffer was written out
+		written, err = h.service.ExportOrders(c, filter, w)
+		if err == nil {
+			err = w.Close()
+		}
+		if err == nil {
+			h.logger.Info("orders exported", zap.String("format", string(format)), zap.Int("num_orders", written))
+			return
+		}
+	}
+
+	h.logger.Error("failed to export orders", zap.Error(err))
+	if !c.Writer.Written() {
+		for _, key := range []string{"Content-Type", "Content-Disposition", "Trailer"} {
+			c.Writer.Header().Del(key)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to export orders"})
+		return
+	}
+	c.Writer.Header().Set(exportErrorTrailer, err.Error())
+}
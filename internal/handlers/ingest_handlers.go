@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yokitheyo/wb_level0/internal/services"
+	"go.uber.org/zap"
+)
+
+const (
+	maxOrderBytes      = 1 << 20  // 1MB
+	maxBatchBytes      = 64 << 20 // 64MB
+	maxBatchOrders     = 1000
+	maxIdempotencyKey  = 200
+	idempotencyKeyName = "Idempotency-Key"
+	// schemaVersionName declares the order contract version of the body.
+	schemaVersionName = "X-Schema-Version"
+)
+
+// CreateOrder ingests one JSON order. It answers 201 for a new order, 200 if
+// the order was updated or already known, 422 if it is invalid or its
+// Idempotency-Key was used for another body and 503 if it could not be saved
+// and may be retried.
+func (h *OrderHandler) CreateOrder(c *gin.Context) {
+	key, schemaVersion, ok := ingestHeaders(c)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxOrderBytes))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "order is too large"})
+		return
+	}
+
+	result, err := h.service.IngestOrder(c, services.Message{
+		Data:           body,
+		IdempotencyKey: key,
+		SchemaVersion:  schemaVersion,
+	})
+	if err != nil {
+		h.logger.Error("failed to ingest order", zap.Error(err), zap.String("order_uid", result.OrderUID))
+		c.JSON(persistFailureStatus(err), result)
+		return
+	}
+
+	switch result.Status {
+	case services.IngestCreated:
+		c.JSON(http.StatusCreated, result)
+	case services.IngestInvalid, services.IngestConflict:
+		c.JSON(http.StatusUnprocessableEntity, result)
+	default:
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// CreateOrders ingests newline-delimited JSON orders in one transaction and
+// reports a result per line. With an Idempotency-Key header, line n is keyed
+// as "<key>:<n>", counting non-empty lines from 0.
+func (h *OrderHandler) CreateOrders(c *gin.Context) {
+	key, schemaVersion, ok := ingestHeaders(c)
+	if !ok {
+		return
+	}
+
+	var orders [][]byte
+	scanner := bufio.NewScanner(http.MaxBytesReader(c.Writer, c.Request.Body, maxBatchBytes))
+	scanner.Buffer(make([]byte, 64*1024), maxOrderBytes)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if len(orders) == maxBatchOrders {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "batch holds more than " + strconv.Itoa(maxBatchOrders) + " orders"})
+			return
+		}
+		orders = append(orders, append([]byte(nil), line...))
+	}
+	if err := scanner.Err(); err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.Is(err, bufio.ErrTooLong) || errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		c.JSON(status, gin.H{"error": "failed to read batch: " + err.Error()})
+		return
+	}
+	if len(orders) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "batch is empty"})
+		return
+	}
+
+	msgs := make([]services.Message, len(orders))
+	for i, order := range orders {
+		msgs[i] = services.Message{Data: order, SchemaVersion: schemaVersion}
+		if key != "" {
+			msgs[i].IdempotencyKey = key + ":" + strconv.Itoa(i)
+		}
+	}
+
+	results, err := h.service.IngestOrders(c, msgs)
+	summary := make(map[services.IngestStatus]int)
+	for _, result := range results {
+		summary[result.Status]++
+	}
+
+	status := http.StatusOK
+	if err != nil {
+		h.logger.Error("failed to ingest orders", zap.Error(err), zap.Int("num_orders", len(orders)))
+		status = persistFailureStatus(err)
+	}
+	c.JSON(status, gin.H{
+		"results": results,
+		"summary": summary,
+	})
+}
+
+// ingestHeaders returns the Idempotency-Key and X-Schema-Version headers, or
+// answers 400 and returns false if either is too long.
+func ingestHeaders(c *gin.Context) (key, schemaVersion string, ok bool) {
+	key = c.GetHeader(idempotencyKeyName)
+	if len(key) > maxIdempotencyKey {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+		return "", "", false
+	}
+	schemaVersion = c.GetHeader(schemaVersionName)
+	if len(schemaVersion) > services.MaxSchemaVersionLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "X-Schema-Version is too long"})
+		return "", "", false
+	}
+	return key, schemaVersion, true
+}
+
+func persistFailureStatus(err error) int {
+	if services.IsRetryable(err) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yokitheyo/wb_level0/internal/repository"
+	"go.uber.org/zap"
+)
+
+func (h *OrderHandler) GetOrdersByTrackNumber(c *gin.Context) {
+	trackNumber := c.Param("track_number")
+	limit, err := lookupLimit(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	orders, more, err := h.service.GetOrdersByTrackNumber(c, trackNumber, limit)
+	if err != nil {
+		h.logger.Error("failed to get orders by track number", zap.Error(err), zap.String("track_number", trackNumber))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"track_number": trackNumber,
+		"orders":       orders,
+		"has_more":     more,
+	})
+}
+
+// GetOrdersByCustomer returns the newest orders of a customer. If has_more
+// is set, the rest can be paged through with GET /orders?customer_id=.
+func (h *OrderHandler) GetOrdersByCustomer(c *gin.Context) {
+	customerID := c.Param("customer_id")
+	limit, err := lookupLimit(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	orders, more, err := h.service.GetOrdersByCustomer(c, customerID, limit)
+	if err != nil {
+		h.logger.Error("failed to get orders by customer", zap.Error(err), zap.String("customer_id", customerID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"customer_id": customerID,
+		"orders":      orders,
+		"has_more":    more,
+	})
+}
+
+func lookupLimit(c *gin.Context) (int, error) {
+	raw := c.Query("limit")
+	if raw == "" {
+		return repository.DefaultSearchLimit, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 || n > repository.MaxSearchLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", repository.MaxSearchLimit)
+	}
+	return n, nil
+}
@@ -2,12 +2,18 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/yokitheyo/wb_level0/internal/services"
 	"go.uber.org/zap"
 )
 
+const (
+	defaultUIDPageSize = 100
+	maxUIDPageSize     = 1000
+)
+
 type OrderHandler struct {
 	service services.OrderService
 	logger  *zap.Logger
@@ -27,7 +33,7 @@ func (h *OrderHandler) GetOrderByID(c *gin.Context) {
 		return
 	}
 
-	order, err := h.service.GetOrderByID(c, orderUID)
+	order, err := h.service.GetOrderByID(c.Request.Context(), orderUID)
 	if err != nil {
 		h.logger.Error("failed to get order", zap.Error(err), zap.String("order_uid", orderUID))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get order"})
@@ -41,6 +47,39 @@ func (h *OrderHandler) GetOrderByID(c *gin.Context) {
 	c.JSON(http.StatusOK, order)
 }
 
+func (h *OrderHandler) GetOrderHistory(c *gin.Context) {
+	orderUID := c.Param("order_uid")
+	if orderUID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order_uid is required"})
+		return
+	}
+
+	revisions, err := h.service.GetOrderHistory(c, orderUID)
+	if err != nil {
+		h.logger.Error("failed to get order history", zap.Error(err), zap.String("order_uid", orderUID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get order history"})
+		return
+	}
+
+	if len(revisions) == 0 {
+		order, err := h.service.GetOrderByID(c.Request.Context(), orderUID)
+		if err != nil {
+			h.logger.Error("failed to get order", zap.Error(err), zap.String("order_uid", orderUID))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get order"})
+			return
+		}
+		if order == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"order_uid": orderUID,
+		"revisions": revisions,
+	})
+}
+
 func (h *OrderHandler) GetHomePage(c *gin.Context) {
 	c.HTML(http.StatusOK, "index.html", gin.H{
 		"title": "Сервис заказов WB Level 0",
@@ -52,8 +91,56 @@ func (h *OrderHandler) GetCacheStats(c *gin.Context) {
 	c.JSON(http.StatusOK, stats)
 }
 
+// ListCachedUIDs pages through the cached order UIDs. The next_cursor of a
+// response is passed as ?after= to fetch the following page.
+func (h *OrderHandler) ListCachedUIDs(c *gin.Context) {
+	limit := defaultUIDPageSize
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		limit = min(n, maxUIDPageSize)
+	}
+
+	uids := h.service.ListCachedUIDs(c.Query("after"), c.Query("prefix"), limit)
+
+	var next string
+	if len(uids) == limit {
+		next = uids[len(uids)-1]
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"order_uids":  uids,
+		"next_cursor": next,
+	})
+}
+
+func (h *OrderHandler) GetLastVerification(c *gin.Context) {
+	report := h.service.LastVerification()
+	if report == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "cache has not been verified yet"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func (h *OrderHandler) GetWarmupStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, h.service.GetWarmupStatus())
+}
+
 func (h *OrderHandler) RegisterRoutes(router *gin.Engine) {
 	router.GET("/", h.GetHomePage)
 	router.GET("/order/:order_uid", h.GetOrderByID)
+	router.GET("/orders", h.SearchOrders)
+	router.GET("/orders/export", h.ExportOrders)
+	router.POST("/orders", h.CreateOrder)
+	router.POST("/orders/batch", h.CreateOrders)
+	router.GET("/orders/by-track/:track_number", h.GetOrdersByTrackNumber)
+	router.GET("/customers/:customer_id/orders", h.GetOrdersByCustomer)
+	router.GET("/order/:order_uid/history", h.GetOrderHistory)
 	router.GET("/cache/stats", h.GetCacheStats)
+	router.GET("/cache/uids", h.ListCachedUIDs)
+	router.GET("/cache/warmup", h.GetWarmupStatus)
+	router.GET("/cache/verify", h.GetLastVerification)
 }
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yokitheyo/wb_level0/internal/repository"
+	"go.uber.org/zap"
+)
+
+// SearchOrders lists orders matching the query parameters, newest first
+// unless ?order=asc. The next_cursor of a response is passed as ?cursor=
+// to fetch the following page.
+func (h *OrderHandler) SearchOrders(c *gin.Context) {
+	q, err := parseOrderQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.service.SearchOrders(c, q)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error("failed to search orders", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search orders"})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func parseOrderQuery(c *gin.Context) (repository.OrderQuery, error) {
+	filter, err := parseOrderFilter(c)
+	if err != nil {
+		return repository.OrderQuery{}, err
+	}
+	q := repository.OrderQuery{
+		Filter: filter,
+		Sort:   repository.SortNewestFirst,
+		Limit:  repository.DefaultSearchLimit,
+		Cursor: c.Query("cursor"),
+	}
+
+	switch order := c.Query("order"); order {
+	case "", string(repository.SortNewestFirst):
+	case string(repository.SortOldestFirst):
+		q.Sort = repository.SortOldestFirst
+	default:
+		return q, fmt.Errorf("order must be asc or desc")
+	}
+
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > repository.MaxSearchLimit {
+			return q, fmt.Errorf("limit must be between 1 and %d", repository.MaxSearchLimit)
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+func parseOrderFilter(c *gin.Context) (repository.OrderFilter, error) {
+	filter := repository.OrderFilter{
+		CustomerID:      c.Query("customer_id"),
+		TrackNumber:     c.Query("track_number"),
+		DeliveryService: c.Query("delivery_service"),
+		Currency:        c.Query("currency"),
+		Provider:        c.Query("provider"),
+		Brand:           c.Query("brand"),
+	}
+
+	var err error
+	if filter.CreatedFrom, err = queryTime(c, "created_from"); err != nil {
+		return filter, err
+	}
+	if filter.CreatedTo, err = queryTime(c, "created_to"); err != nil {
+		return filter, err
+	}
+	if raw := c.Query("nm_id"); raw != "" {
+		if filter.NmID, err = strconv.Atoi(raw); err != nil {
+			return filter, fmt.Errorf("nm_id must be an integer")
+		}
+	}
+	return filter, nil
+}
+
+// queryTime parses an RFC 3339 timestamp or a plain date.
+func queryTime(c *gin.Context, key string) (time.Time, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t.UTC(), nil
+	}
+	if t, err := time.Parse(time.DateOnly, raw); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%s must be an RFC 3339 timestamp or a YYYY-MM-DD date", key)
+}
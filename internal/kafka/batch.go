@@ -0,0 +1,166 @@
+package kafka
+
+import (
+	"context"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/yokitheyo/wb_level0/internal/services"
+	"go.uber.org/zap"
+)
+
+// consumeBatches accumulates up to batchSize messages, or whatever arrived
+// within batchTimeout of the first one, and saves them in one transaction.
+func (c *Consumer) consumeBatches(ctx context.Context) {
+	fetched := make(chan kafka.Message, c.batchSize)
+	go func() {
+		defer close(fetched)
+		for {
+			msg, err := c.reader.FetchMessage(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				c.logger.Error("failed to fetch message from kafka", zap.Error(err))
+				continue
+			}
+			select {
+			case fetched <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	batch := make([]kafka.Message, 0, c.batchSize)
+	timer := time.NewTimer(c.batchTimeout)
+	timer.Stop()
+	defer timer.Stop()
+
+	flush := func() bool {
+		timer.Stop()
+		if len(batch) == 0 {
+			return true
+		}
+		ok := c.handleBatch(ctx, batch)
+		batch = batch[:0]
+		return ok
+	}
+
+	for {
+		select {
+		case msg, ok := <-fetched:
+			if !ok {
+				return
+			}
+			if len(batch) == 0 {
+				timer.Reset(c.batchTimeout)
+			}
+			batch = append(batch, msg)
+			if len(batch) >= c.batchSize && !flush() {
+				return
+			}
+		case <-timer.C:
+			if !flush() {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handleBatch is the batch counterpart of handleMessage: every message is
+// either persisted or dead-lettered before the batch's offsets are
+// committed.
+func (c *Consumer) handleBatch(ctx context.Context, batch []kafka.Message) bool {
+	c.logger.Debug("processing batch of messages", zap.Int("batch_size", len(batch)))
+
+	pending := batch
+	attempt := 0
+	for len(pending) > 0 {
+		if wait := c.breaker.wait(); wait > 0 {
+			if !sleep(ctx, wait) {
+				return false
+			}
+			continue
+		}
+
+		msgs := make([]services.Message, len(pending))
+		for i, msg := range pending {
+			msgs[i] = c.orderMessage(msg)
+		}
+		errs := c.service.ProcessOrders(ctx, msgs)
+		if ctx.Err() != nil {
+			return false
+		}
+
+		var lastErr error
+		for _, err := range errs {
+			if err != nil && services.IsRetryable(err) {
+				lastErr = err
+			}
+		}
+
+		giveUp := false
+		if lastErr == nil {
+			c.breaker.success()
+			attempt = 0
+		} else {
+			if c.breaker.failure() {
+				c.logger.Warn("circuit breaker opened, pausing consumption",
+					zap.Error(lastErr),
+					zap.Duration("open_timeout", c.breaker.openTimeout),
+				)
+			}
+			// failures while the breaker is open do not use up the attempts
+			if !c.breaker.isOpen() {
+				attempt++
+				giveUp = attempt >= c.retry.maxAttempts
+			}
+		}
+
+		var retry []kafka.Message
+		for i, err := range errs {
+			if err == nil {
+				continue
+			}
+			if services.IsRetryable(err) && !giveUp {
+				retry = append(retry, pending[i])
+				continue
+			}
+			if !c.deadLetter(ctx, pending[i], err) {
+				retry = append(retry, pending[i])
+			}
+		}
+
+		pending = retry
+		if len(pending) == 0 {
+			break
+		}
+		if c.breaker.isOpen() {
+			continue
+		}
+
+		delay := c.retry.maxBackoff
+		if lastErr != nil {
+			delay = c.retry.backoff(attempt)
+		}
+		c.logger.Error("failed to process batch, will retry",
+			zap.Error(lastErr),
+			zap.Int("pending", len(pending)),
+			zap.Int("attempt", attempt),
+			zap.Duration("retry_in", delay),
+		)
+		if !sleep(ctx, delay) {
+			return false
+		}
+	}
+
+	commitCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), commitTimeout)
+	defer cancel()
+	if err := c.reader.CommitMessages(commitCtx, batch...); err != nil {
+		c.logger.Error("failed to commit batch offsets", zap.Error(err), zap.Int("batch_size", len(batch)))
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+package kafka
+
+import (
+	"sync"
+	"time"
+
+	"github.com/yokitheyo/wb_level0/internal/config"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// probePollInterval is how often callers check whether the half-open probe
+// has settled the breaker.
+const probePollInterval = 50 * time.Millisecond
+
+// circuitBreaker stops message processing after a run of consecutive
+// transient failures, e.g. while the database is unreachable. Once
+// openTimeout has elapsed a single probe attempt is let through: success
+// closes the breaker, failure opens it again.
+type circuitBreaker struct {
+	mu          sync.Mutex
+	threshold   int
+	openTimeout time.Duration
+	state       breakerState
+	failures    int
+	openedAt    time.Time
+	// probing is set while the half-open probe is in flight; other callers
+	// wait until it settles the state
+	probing bool
+}
+
+func newCircuitBreaker(cfg config.CircuitBreakerConfig) *circuitBreaker {
+	return &circuitBreaker{
+		threshold:   cfg.FailureThreshold,
+		openTimeout: cfg.OpenTimeout,
+	}
+}
+
+func (b *circuitBreaker) enabled() bool {
+	return b.threshold > 0
+}
+
+// wait returns how long the caller must pause before the next attempt. In
+// half-open state only the first caller may go ahead as the probe; it must
+// report the outcome with success, failure or abandonProbe.
+func (b *circuitBreaker) wait() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerClosed:
+		return 0
+	case breakerOpen:
+		if remaining := b.openTimeout - time.Since(b.openedAt); remaining > 0 {
+			return remaining
+		}
+		b.state = breakerHalfOpen
+	}
+
+	if b.probing {
+		return probePollInterval
+	}
+	b.probing = true
+	return 0
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = breakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// abandonProbe lets another caller probe when an attempt ended without
+// telling whether the database is back, e.g. because the order was invalid.
+func (b *circuitBreaker) abandonProbe() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// failure records a transient failure and reports whether it opened the
+// breaker.
+func (b *circuitBreaker) failure() bool {
+	if !b.enabled() {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == breakerHalfOpen || (b.state == breakerClosed && b.failures >= b.threshold) {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+		return true
+	}
+	return false
+}
+
+func (b *circuitBreaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == breakerOpen
+}
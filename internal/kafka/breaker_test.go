@@ -0,0 +1,60 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yokitheyo/wb_level0/internal/config"
+)
+
+func TestCircuitBreakerLetsOneProbeThrough(t *testing.T) {
+	b := newCircuitBreaker(config.CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Millisecond})
+	if !b.failure() {
+		t.Fatal("expected the first failure to open the breaker")
+	}
+	time.Sleep(2 * time.Millisecond)
+
+	if wait := b.wait(); wait != 0 {
+		t.Fatalf("expected the first caller to probe, got wait %v", wait)
+	}
+	for i := 0; i < 3; i++ {
+		if wait := b.wait(); wait == 0 {
+			t.Fatal("expected other callers to wait for the probe")
+		}
+	}
+
+	b.success()
+	for i := 0; i < 3; i++ {
+		if wait := b.wait(); wait != 0 {
+			t.Fatalf("expected a closed breaker to let callers through, got wait %v", wait)
+		}
+	}
+}
+
+func TestCircuitBreakerReopensWhenProbeFails(t *testing.T) {
+	b := newCircuitBreaker(config.CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Hour})
+	b.failure()
+	b.openedAt = time.Now().Add(-2 * time.Hour)
+
+	if wait := b.wait(); wait != 0 {
+		t.Fatalf("expected the first caller to probe, got wait %v", wait)
+	}
+	if !b.failure() {
+		t.Fatal("expected a failed probe to open the breaker again")
+	}
+	if wait := b.wait(); wait < time.Minute {
+		t.Fatalf("expected to wait for the open timeout, got %v", wait)
+	}
+}
+
+func TestCircuitBreakerAbandonedProbe(t *testing.T) {
+	b := newCircuitBreaker(config.CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Hour})
+	b.failure()
+	b.openedAt = time.Now().Add(-2 * time.Hour)
+
+	b.wait()
+	b.abandonProbe()
+	if wait := b.wait(); wait != 0 {
+		t.Fatalf("expected the next caller to probe after an abandoned probe, got wait %v", wait)
+	}
+}
@@ -2,69 +2,362 @@ package kafka
 
 import (
 	"context"
+	"encoding/json"
+	"hash/fnv"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/segmentio/kafka-go"
+	"github.com/yokitheyo/wb_level0/internal/config"
 	"github.com/yokitheyo/wb_level0/internal/services"
 	"go.uber.org/zap"
 )
 
+const commitTimeout = 5 * time.Second
+
+// HeaderSchemaVersion carries the version of the order contract the
+// producer wrote the message with.
+const HeaderSchemaVersion = "x-schema-version"
+
+// MessageReader is the subset of *kafka.Reader used by the consumer.
+type MessageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// DeadLetterPublisher receives messages that cannot be processed.
+type DeadLetterPublisher interface {
+	Publish(ctx context.Context, msg kafka.Message, cause error) error
+}
+
 type Consumer struct {
-	reader  *kafka.Reader
-	service services.OrderService
-	logger  *zap.Logger
+	reader       MessageReader
+	service      services.OrderService
+	dlq          DeadLetterPublisher
+	retry        retryPolicy
+	breaker      *circuitBreaker
+	workers      int
+	queueSize    int
+	batchSize    int
+	batchTimeout time.Duration
+	logger       *zap.Logger
+	done         chan struct{}
 }
 
-func NewConsumer(brokers []string,
-	topic, groupID string,
+func NewConsumer(cfg *config.KafkaConfig,
 	service services.OrderService,
+	dlq DeadLetterPublisher,
 	logger *zap.Logger) *Consumer {
 	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:        brokers,
-		Topic:          topic,
-		GroupID:        groupID,
-		MinBytes:       10e3, // 10KB
-		MaxBytes:       10e6, // 10MB
-		MaxWait:        1 * time.Second,
-		StartOffset:    kafka.FirstOffset,
-		CommitInterval: 1 * time.Second,
+		Brokers:     cfg.Brokers,
+		Topic:       cfg.Topic,
+		GroupID:     cfg.GroupID,
+		MinBytes:    10e3, // 10KB
+		MaxBytes:    10e6, // 10MB
+		MaxWait:     1 * time.Second,
+		StartOffset: kafka.FirstOffset,
+		// offsets are committed synchronously after the order is persisted
+		CommitInterval: 0,
 	})
+	return NewConsumerWithReader(reader, cfg, service, dlq, logger)
+}
+
+// NewConsumerWithReader builds a consumer around an existing reader. dlq may
+// be nil, in which case rejected messages are only logged and skipped.
+func NewConsumerWithReader(reader MessageReader,
+	cfg *config.KafkaConfig,
+	service services.OrderService,
+	dlq DeadLetterPublisher,
+	logger *zap.Logger) *Consumer {
+	workers := cfg.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	queueSize := cfg.WorkerQueueSize
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	batchTimeout := cfg.BatchTimeout
+	if batchTimeout <= 0 {
+		batchTimeout = 500 * time.Millisecond
+	}
+
 	return &Consumer{
-		reader:  reader,
-		service: service,
-		logger:  logger,
+		reader:       reader,
+		service:      service,
+		dlq:          dlq,
+		retry:        newRetryPolicy(cfg.Retry),
+		breaker:      newCircuitBreaker(cfg.CircuitBreaker),
+		workers:      workers,
+		queueSize:    queueSize,
+		batchSize:    cfg.BatchSize,
+		batchTimeout: batchTimeout,
+		logger:       logger,
+		done:         make(chan struct{}),
 	}
 }
 
 func (c *Consumer) Start(ctx context.Context) {
-	c.logger.Info("starting kafka consumer")
+	c.logger.Info("starting kafka consumer",
+		zap.Int("workers", c.workers),
+		zap.Int("batch_size", c.batchSize),
+	)
 
 	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				c.logger.Info("stopping kafka consumer")
-				if err := c.reader.Close(); err != nil {
-					c.logger.Error("failed to close kafka reader", zap.Error(err))
-				}
-				return
-			default:
-				msg, err := c.reader.ReadMessage(ctx)
-				if err != nil {
-					c.logger.Error("failed to read message from kafka", zap.Error(err))
-					continue
-				}
-
-				c.logger.Debug("received message from kafka",
-					zap.String("topic", msg.Topic),
-					zap.Int("partition", msg.Partition),
-					zap.Int64("offset", msg.Offset),
-				)
-				if err := c.service.ProcessOrder(ctx, msg.Value); err != nil {
-					c.logger.Error("failed to process order", zap.Error(err))
-					continue
-				}
+		defer close(c.done)
+		defer func() {
+			c.logger.Info("stopping kafka consumer")
+			if err := c.reader.Close(); err != nil {
+				c.logger.Error("failed to close kafka reader", zap.Error(err))
 			}
+		}()
+
+		if c.batchSize > 1 {
+			c.consumeBatches(ctx)
+		} else {
+			c.consumeParallel(ctx)
 		}
 	}()
 }
+
+func (c *Consumer) consumeParallel(ctx context.Context) {
+	tracker := newOffsetTracker()
+	completed := make(chan kafka.Message, c.queueSize)
+	queues := make([]chan kafka.Message, c.workers)
+
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan kafka.Message, c.queueSize)
+		wg.Add(1)
+		go func(queue <-chan kafka.Message) {
+			defer wg.Done()
+			c.runWorker(ctx, queue, completed)
+		}(queues[i])
+	}
+
+	committerDone := make(chan struct{})
+	go func() {
+		defer close(committerDone)
+		c.runCommitter(ctx, tracker, completed)
+	}()
+
+	c.fetchLoop(ctx, tracker, queues)
+
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+	close(completed)
+	<-committerDone
+}
+
+func (c *Consumer) fetchLoop(ctx context.Context, tracker *offsetTracker, queues []chan kafka.Message) {
+	for {
+		msg, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			c.logger.Error("failed to fetch message from kafka", zap.Error(err))
+			continue
+		}
+
+		c.logger.Debug("received message from kafka",
+			zap.String("topic", msg.Topic),
+			zap.Int("partition", msg.Partition),
+			zap.Int64("offset", msg.Offset),
+		)
+
+		tracker.track(msg)
+		select {
+		case queues[workerIndex(msg, len(queues))] <- msg:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *Consumer) runWorker(ctx context.Context, queue <-chan kafka.Message, completed chan<- kafka.Message) {
+	for msg := range queue {
+		if ctx.Err() != nil || !c.handleMessage(ctx, msg) {
+			continue
+		}
+		completed <- msg
+	}
+}
+
+// runCommitter is the only goroutine that commits offsets, so commits for a
+// partition are issued in increasing order.
+func (c *Consumer) runCommitter(ctx context.Context, tracker *offsetTracker, completed <-chan kafka.Message) {
+	for msg := range completed {
+		next, ok := tracker.complete(msg)
+		if !ok {
+			continue
+		}
+
+		// finished work is still committed while the consumer shuts down
+		commitCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), commitTimeout)
+		err := c.reader.CommitMessages(commitCtx, next)
+		cancel()
+		if err != nil {
+			c.logger.Error("failed to commit message offset",
+				zap.Error(err),
+				zap.Int("partition", next.Partition),
+				zap.Int64("offset", next.Offset),
+			)
+		}
+	}
+}
+
+// workerIndex keeps messages for one order on one worker so that they are
+// processed in the order they were produced. Messages without a key are
+// routed by order_uid, and unparseable ones by partition.
+func workerIndex(msg kafka.Message, workers int) int {
+	key := msg.Key
+	if len(key) == 0 {
+		var probe struct {
+			OrderUID string `json:"order_uid"`
+		}
+		if err := json.Unmarshal(msg.Value, &probe); err == nil && probe.OrderUID != "" {
+			key = []byte(probe.OrderUID)
+		} else {
+			key = []byte(strconv.Itoa(msg.Partition))
+		}
+	}
+
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % uint32(workers))
+}
+
+// Done is closed once the consumer loop has exited and the reader is closed.
+func (c *Consumer) Done() <-chan struct{} {
+	return c.done
+}
+
+// handleMessage processes msg until it is either persisted or routed to the
+// dead-letter topic; only then may its offset be committed. Permanent errors
+// are dead-lettered straight away; transient ones are retried with backoff
+// until the attempts run out. Failures while the circuit breaker is open or
+// probing do not count as attempts: the message is held until the database
+// is back, however long that takes. It returns false if ctx was cancelled before the
+// message could be handled, so that its offset is left uncommitted and the
+// message is redelivered after a restart.
+func (c *Consumer) handleMessage(ctx context.Context, msg kafka.Message) bool {
+	order := c.orderMessage(msg)
+	attempt := 0
+	for {
+		if wait := c.breaker.wait(); wait > 0 {
+			if !sleep(ctx, wait) {
+				return false
+			}
+			continue
+		}
+
+		err := c.service.ProcessOrder(ctx, order)
+		if err == nil {
+			c.breaker.success()
+			break
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+
+		if !services.IsRetryable(err) {
+			c.breaker.abandonProbe()
+			if c.deadLetter(ctx, msg, err) {
+				break
+			}
+			if !sleep(ctx, c.retry.maxBackoff) {
+				return false
+			}
+			continue
+		}
+
+		if c.breaker.failure() {
+			c.logger.Warn("circuit breaker opened, pausing consumption",
+				zap.Error(err),
+				zap.Duration("open_timeout", c.breaker.openTimeout),
+			)
+		}
+		if c.breaker.isOpen() {
+			continue
+		}
+
+		attempt++
+		if attempt >= c.retry.maxAttempts {
+			if c.deadLetter(ctx, msg, err) {
+				break
+			}
+			attempt--
+		}
+
+		delay := c.retry.backoff(attempt)
+		c.logger.Error("failed to process order, will retry",
+			zap.Error(err),
+			zap.Int("partition", msg.Partition),
+			zap.Int64("offset", msg.Offset),
+			zap.Int("attempt", attempt),
+			zap.Duration("retry_in", delay),
+		)
+		if !sleep(ctx, delay) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// deadLetter routes a rejected message to the dead-letter topic. It returns
+// false if the message could not be published and must not be committed yet.
+func (c *Consumer) deadLetter(ctx context.Context, msg kafka.Message, cause error) bool {
+	if c.dlq == nil {
+		c.logger.Error("skipping order that cannot be processed",
+			zap.Error(cause),
+			zap.Int("partition", msg.Partition),
+			zap.Int64("offset", msg.Offset),
+		)
+		return true
+	}
+
+	if err := c.dlq.Publish(ctx, msg, cause); err != nil {
+		c.logger.Error("failed to publish order to dead-letter topic, will retry",
+			zap.Error(err),
+			zap.Int("partition", msg.Partition),
+			zap.Int64("offset", msg.Offset),
+		)
+		return false
+	}
+	return true
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+func (c *Consumer) orderMessage(msg kafka.Message) services.Message {
+	m := services.Message{Data: msg.Value}
+	for _, h := range msg.Headers {
+		if h.Key != HeaderSchemaVersion {
+			continue
+		}
+		if len(h.Value) > services.MaxSchemaVersionLength {
+			c.logger.Warn("schema version header is too long, ignoring it",
+				zap.Int("partition", msg.Partition),
+				zap.Int64("offset", msg.Offset),
+			)
+			break
+		}
+		m.SchemaVersion = string(h.Value)
+	}
+	return m
+}
@@ -0,0 +1,360 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/segmentio/kafka-go"
+	"github.com/yokitheyo/wb_level0/internal/cache"
+	"github.com/yokitheyo/wb_level0/internal/config"
+	"github.com/yokitheyo/wb_level0/internal/models"
+	"github.com/yokitheyo/wb_level0/internal/repository"
+	"github.com/yokitheyo/wb_level0/internal/services"
+	"github.com/yokitheyo/wb_level0/internal/validator"
+	"go.uber.org/zap"
+)
+
+// fakeReader serves a fixed list of messages and records commits. resume
+// starts it over from the committed offset, like a consumer group member
+// that joins after another one stopped.
+type fakeReader struct {
+	mu      sync.Mutex
+	msgs    []kafka.Message
+	next    int
+	commits []kafka.Message
+}
+
+func newFakeReader(n int) *fakeReader {
+	r := &fakeReader{}
+	for i := 0; i < n; i++ {
+		r.msgs = append(r.msgs, kafka.Message{
+			Topic:     "orders",
+			Partition: 0,
+			Offset:    int64(i),
+			Key:       []byte("order-" + strconv.Itoa(i)),
+			Value:     []byte(`{"order_uid":"order-` + strconv.Itoa(i) + `"}`),
+		})
+	}
+	return r
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	r.mu.Lock()
+	if r.next < len(r.msgs) {
+		msg := r.msgs[r.next]
+		r.next++
+		r.mu.Unlock()
+		return msg, nil
+	}
+	r.mu.Unlock()
+
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (r *fakeReader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commits = append(r.commits, msgs...)
+	return nil
+}
+
+func (r *fakeReader) Close() error {
+	return nil
+}
+
+func (r *fakeReader) resume() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.next = 0
+	for _, msg := range r.commits {
+		if int(msg.Offset)+1 > r.next {
+			r.next = int(msg.Offset) + 1
+		}
+	}
+}
+
+func (r *fakeReader) committed() []kafka.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]kafka.Message(nil), r.commits...)
+}
+
+// fakeService implements only the methods the consumer calls.
+type fakeService struct {
+	services.OrderService
+	process func(msg services.Message) error
+}
+
+func (s *fakeService) ProcessOrder(_ context.Context, msg services.Message) error {
+	return s.process(msg)
+}
+
+func (s *fakeService) ProcessOrders(_ context.Context, msgs []services.Message) []error {
+	errs := make([]error, len(msgs))
+	for i, msg := range msgs {
+		errs[i] = s.process(msg)
+	}
+	return errs
+}
+
+type fakeDLQ struct {
+	mu        sync.Mutex
+	published []kafka.Message
+}
+
+func (q *fakeDLQ) Publish(_ context.Context, msg kafka.Message, _ error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.published = append(q.published, msg)
+	return nil
+}
+
+func (q *fakeDLQ) messages() []kafka.Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]kafka.Message(nil), q.published...)
+}
+
+var errTransient = &services.ProcessError{Stage: services.StagePersist, Retryable: true, Err: errors.New("connection refused")}
+
+func testConfig(workers int) *config.KafkaConfig {
+	return &config.KafkaConfig{
+		Workers:         workers,
+		WorkerQueueSize: 10,
+		Retry: config.RetryConfig{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     2 * time.Millisecond,
+		},
+	}
+}
+
+// startConsumer runs the consumer until the test ends.
+func startConsumer(t *testing.T, reader MessageReader, cfg *config.KafkaConfig, service services.OrderService, dlq DeadLetterPublisher) (*Consumer, context.CancelFunc) {
+	t.Helper()
+	consumer := NewConsumerWithReader(reader, cfg, service, dlq, zap.NewNop())
+	ctx, cancel := context.WithCancel(context.Background())
+	consumer.Start(ctx)
+	t.Cleanup(func() {
+		cancel()
+		<-consumer.Done()
+	})
+	return consumer, cancel
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConsumerCommitsOnlyAfterSuccess(t *testing.T) {
+	reader := newFakeReader(1)
+	var calls atomic.Int32
+	var committedEarly atomic.Bool
+	service := &fakeService{process: func(services.Message) error {
+		if len(reader.committed()) > 0 {
+			committedEarly.Store(true)
+		}
+		if calls.Add(1) < 3 {
+			return errTransient
+		}
+		return nil
+	}}
+
+	startConsumer(t, reader, testConfig(1), service, &fakeDLQ{})
+	waitFor(t, "commit", func() bool { return len(reader.committed()) == 1 })
+
+	if committedEarly.Load() {
+		t.Fatal("offset was committed before the order was saved")
+	}
+	if got := calls.Load(); got != 3 {
+		t.Fatalf("expected 3 attempts, got %d", got)
+	}
+	if got := reader.committed()[0].Offset; got != 0 {
+		t.Fatalf("expected offset 0 to be committed, got %d", got)
+	}
+}
+
+func TestConsumerLeavesFailedMessageUncommittedOnShutdown(t *testing.T) {
+	reader := newFakeReader(1)
+	var calls atomic.Int32
+	service := &fakeService{process: func(services.Message) error {
+		calls.Add(1)
+		return errTransient
+	}}
+	cfg := testConfig(1)
+	cfg.Retry.MaxAttempts = 1000
+
+	consumer, cancel := startConsumer(t, reader, cfg, service, &fakeDLQ{})
+	waitFor(t, "retries", func() bool { return calls.Load() >= 3 })
+	cancel()
+	<-consumer.Done()
+
+	if commits := reader.committed(); len(commits) != 0 {
+		t.Fatalf("expected the message to stay uncommitted for redelivery, got commits %v", commits)
+	}
+
+	// the next consumer of the partition gets the message again
+	reader.resume()
+	var mu sync.Mutex
+	var saved []string
+	recovered := &fakeService{process: func(msg services.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		saved = append(saved, string(msg.Data))
+		return nil
+	}}
+	dlq := &fakeDLQ{}
+	startConsumer(t, reader, cfg, recovered, dlq)
+	waitFor(t, "commit", func() bool { return len(reader.committed()) == 1 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(saved) != 1 || saved[0] != `{"order_uid":"order-0"}` {
+		t.Fatalf("expected the redelivered message to be saved once, got %v", saved)
+	}
+	if got := reader.committed()[0].Offset; got != 0 {
+		t.Fatalf("expected offset 0 to be committed, got %d", got)
+	}
+	if got := len(dlq.messages()); got != 0 {
+		t.Fatalf("expected no dead-lettered messages, got %d", got)
+	}
+}
+
+func TestConsumerCommitsInOrderAcrossWorkers(t *testing.T) {
+	const n = 40
+	reader := newFakeReader(n)
+	service := &fakeService{process: func(msg services.Message) error {
+		// earlier messages finish later, so workers complete out of order
+		uid := strings.TrimSuffix(strings.TrimPrefix(string(msg.Data), `{"order_uid":"order-`), `"}`)
+		i, _ := strconv.Atoi(uid)
+		time.Sleep(time.Duration(n-i) * 100 * time.Microsecond)
+		return nil
+	}}
+
+	startConsumer(t, reader, testConfig(4), service, &fakeDLQ{})
+	waitFor(t, "last commit", func() bool {
+		commits := reader.committed()
+		return len(commits) > 0 && commits[len(commits)-1].Offset == n-1
+	})
+
+	prev := int64(-1)
+	for _, msg := range reader.committed() {
+		if msg.Offset <= prev {
+			t.Fatalf("offset %d committed after %d", msg.Offset, prev)
+		}
+		prev = msg.Offset
+	}
+}
+
+func TestConsumerDeadLettersAfterRetries(t *testing.T) {
+	reader := newFakeReader(1)
+	var calls atomic.Int32
+	service := &fakeService{process: func(services.Message) error {
+		calls.Add(1)
+		return errTransient
+	}}
+	dlq := &fakeDLQ{}
+
+	startConsumer(t, reader, testConfig(1), service, dlq)
+	waitFor(t, "commit", func() bool { return len(reader.committed()) == 1 })
+
+	if got := len(dlq.messages()); got != 1 {
+		t.Fatalf("expected 1 dead-lettered message, got %d", got)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Fatalf("expected 3 attempts before dead-lettering, got %d", got)
+	}
+}
+
+// failingRepository fails every save with err.
+type failingRepository struct {
+	repository.OrderRepository
+	err error
+}
+
+func (r *failingRepository) ProcessedMessages(context.Context, []string) (map[string]repository.ProcessedMessage, error) {
+	return map[string]repository.ProcessedMessage{}, nil
+}
+
+func (r *failingRepository) SaveOrders(context.Context, []models.Order) ([]repository.SaveResult, error) {
+	return nil, r.err
+}
+
+func TestConsumerDeadLettersEncodeErrors(t *testing.T) {
+	// a chrt_id above 2^31 cannot be encoded into an INT column
+	var chrtID pgtype.Int4
+	encodeErr := chrtID.Set(int64(1) << 31)
+	if encodeErr == nil {
+		t.Fatal("expected an encode error")
+	}
+
+	logger := zap.NewNop()
+	service := services.NewOrderService(
+		&failingRepository{err: encodeErr},
+		cache.NewOrderCache(logger),
+		cache.NewNegativeCache(0),
+		validator.NewLenientDecoder(),
+		validator.New(),
+		logger,
+	)
+	cfg := testConfig(1)
+	cfg.CircuitBreaker = config.CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Hour}
+	reader := newFakeReader(1)
+	dlq := &fakeDLQ{}
+
+	startConsumer(t, reader, cfg, service, dlq)
+	waitFor(t, "commit", func() bool { return len(reader.committed()) == 1 })
+
+	if got := len(dlq.messages()); got != 1 {
+		t.Fatalf("expected 1 dead-lettered message, got %d", got)
+	}
+}
+
+func TestConsumerHoldsMessagesWhileBreakerIsOpen(t *testing.T) {
+	const outage = 10
+	for _, batchSize := range []int{0, 2} {
+		t.Run("batch-"+strconv.Itoa(batchSize), func(t *testing.T) {
+			reader := newFakeReader(2)
+			var calls atomic.Int32
+			service := &fakeService{process: func(services.Message) error {
+				if calls.Add(1) <= outage {
+					return errTransient
+				}
+				return nil
+			}}
+			cfg := testConfig(1)
+			cfg.BatchSize = batchSize
+			cfg.BatchTimeout = time.Millisecond
+			cfg.CircuitBreaker = config.CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Millisecond}
+			dlq := &fakeDLQ{}
+
+			startConsumer(t, reader, cfg, service, dlq)
+			waitFor(t, "commits", func() bool {
+				commits := reader.committed()
+				return len(commits) > 0 && commits[len(commits)-1].Offset == 1
+			})
+
+			if got := len(dlq.messages()); got != 0 {
+				t.Fatalf("expected the messages to be held during the outage, got %d dead-lettered", got)
+			}
+			if got := calls.Load(); got <= outage {
+				t.Fatalf("expected the messages to be saved after the outage, got %d attempts", got)
+			}
+		})
+	}
+}
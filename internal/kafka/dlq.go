@@ -0,0 +1,73 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/yokitheyo/wb_level0/internal/services"
+	"go.uber.org/zap"
+)
+
+const (
+	HeaderDLQStage           = "x-dlq-stage"
+	HeaderDLQError           = "x-dlq-error"
+	HeaderDLQSourceTopic     = "x-dlq-source-topic"
+	HeaderDLQSourcePartition = "x-dlq-source-partition"
+	HeaderDLQSourceOffset    = "x-dlq-source-offset"
+	HeaderDLQSourceTimestamp = "x-dlq-source-timestamp"
+	HeaderDLQFailedAt        = "x-dlq-failed-at"
+	// HeaderDLQViolations holds the JSON array of validation violations of
+	// an order rejected at the validate stage.
+	HeaderDLQViolations = "x-dlq-violations"
+)
+
+// DeadLetterQueue republishes messages that could not be processed to a
+// separate topic, keeping the original key, payload and headers.
+type DeadLetterQueue struct {
+	producer *Producer
+	logger   *zap.Logger
+}
+
+func NewDeadLetterQueue(brokers []string, topic string, logger *zap.Logger) *DeadLetterQueue {
+	return &DeadLetterQueue{
+		producer: NewProducer(brokers, topic, logger),
+		logger:   logger,
+	}
+}
+
+func (q *DeadLetterQueue) Publish(ctx context.Context, msg kafka.Message, cause error) error {
+	headers := make([]kafka.Header, 0, len(msg.Headers)+8)
+	headers = append(headers, msg.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: HeaderDLQStage, Value: []byte(services.StageOf(cause))},
+		kafka.Header{Key: HeaderDLQError, Value: []byte(cause.Error())},
+		kafka.Header{Key: HeaderDLQSourceTopic, Value: []byte(msg.Topic)},
+		kafka.Header{Key: HeaderDLQSourcePartition, Value: []byte(strconv.Itoa(msg.Partition))},
+		kafka.Header{Key: HeaderDLQSourceOffset, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		kafka.Header{Key: HeaderDLQSourceTimestamp, Value: []byte(msg.Time.UTC().Format(time.RFC3339Nano))},
+		kafka.Header{Key: HeaderDLQFailedAt, Value: []byte(time.Now().UTC().Format(time.RFC3339Nano))},
+	)
+	if violations := services.ViolationsOf(cause); len(violations) > 0 {
+		if data, err := json.Marshal(violations); err == nil {
+			headers = append(headers, kafka.Header{Key: HeaderDLQViolations, Value: data})
+		}
+	}
+
+	if err := q.producer.SendMessageWithHeaders(ctx, msg.Key, msg.Value, headers); err != nil {
+		return err
+	}
+
+	q.logger.Info("message sent to dead-letter topic",
+		zap.String("stage", string(services.StageOf(cause))),
+		zap.Int("partition", msg.Partition),
+		zap.Int64("offset", msg.Offset),
+	)
+	return nil
+}
+
+func (q *DeadLetterQueue) Close() error {
+	return q.producer.Close()
+}
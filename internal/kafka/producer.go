@@ -64,6 +64,22 @@ func (p *Producer) SendMessageWithKey(ctx context.Context, key, message []byte)
 	return nil
 }
 
+func (p *Producer) SendMessageWithHeaders(ctx context.Context, key, message []byte, headers []kafka.Header) error {
+	err := p.writer.WriteMessages(ctx, kafka.Message{
+		Key:     key,
+		Value:   message,
+		Headers: headers,
+	})
+	if err != nil {
+		p.logger.Error("failed to send message with headers to kafka",
+			zap.Error(err),
+			zap.String("key", string(key)))
+		return err
+	}
+	p.logger.Info("message with headers sent to kafka successfully", zap.String("key", string(key)))
+	return nil
+}
+
 func (p *Producer) Close() error {
 	return p.writer.Close()
 }
@@ -0,0 +1,54 @@
+package kafka
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/yokitheyo/wb_level0/internal/config"
+)
+
+type retryPolicy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	jitter         float64
+}
+
+func newRetryPolicy(cfg config.RetryConfig) retryPolicy {
+	p := retryPolicy{
+		maxAttempts:    cfg.MaxAttempts,
+		initialBackoff: cfg.InitialBackoff,
+		maxBackoff:     cfg.MaxBackoff,
+		jitter:         cfg.Jitter,
+	}
+	if p.maxAttempts < 1 {
+		p.maxAttempts = 1
+	}
+	if p.initialBackoff <= 0 {
+		p.initialBackoff = 100 * time.Millisecond
+	}
+	if p.maxBackoff < p.initialBackoff {
+		p.maxBackoff = p.initialBackoff
+	}
+	if p.jitter < 0 || p.jitter > 1 {
+		p.jitter = 0
+	}
+	return p
+}
+
+// backoff returns the delay before the next attempt, doubling from
+// initialBackoff up to maxBackoff and spreading it by ±jitter.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	d := p.initialBackoff
+	for i := 1; i < attempt && d < p.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.maxBackoff {
+		d = p.maxBackoff
+	}
+	if p.jitter > 0 {
+		delta := float64(d) * p.jitter
+		d = time.Duration(float64(d) - delta + rand.Float64()*2*delta)
+	}
+	return d
+}
@@ -19,6 +19,17 @@ type Order struct {
 	SmID              int       `json:"sm_id" db:"sm_id"`
 	DateCreated       time.Time `json:"date_created" db:"date_created"`
 	OofShard          string    `json:"oof_shard" db:"oof_shard"`
+	Version           int       `json:"version" db:"version"`
+	UpdatedAt         time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// OrderRevision is a previous state of an order, recorded when it was
+// replaced by a newer version.
+type OrderRevision struct {
+	Version    int       `json:"version"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+	Order      Order     `json:"order"`
 }
 
 type Delivery struct {
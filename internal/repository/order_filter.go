@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// OrderFilter narrows the orders returned by IterateOrders, CountOrders and
+// SearchOrders. Zero fields are not filtered on, so a zero value matches
+// every order.
+type OrderFilter struct {
+	CustomerID      string
+	TrackNumber     string
+	DeliveryService string
+	// CreatedFrom and CreatedTo bound date_created, inclusive and exclusive.
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	Currency    string
+	Provider    string
+	// Brand and NmID must both match the same item of the order.
+	Brand string
+	NmID  int
+	// UpdatedSince keeps orders saved or updated at or after this time.
+	UpdatedSince time.Time
+}
+
+// conditions returns the filter as AND clauses on orders aliased as o,
+// appending their parameters to args. Payment and item filters are
+// subqueries so that the clauses do not depend on the joins of the query.
+func (f OrderFilter) conditions(args *[]interface{}) string {
+	var sql strings.Builder
+	param := func(v interface{}) string {
+		*args = append(*args, v)
+		return fmt.Sprintf("$%d", len(*args))
+	}
+	and := func(format string, a ...interface{}) {
+		sql.WriteString("\n          AND ")
+		fmt.Fprintf(&sql, format, a...)
+	}
+
+	if f.CustomerID != "" {
+		and("o.customer_id = %s", param(f.CustomerID))
+	}
+	if f.TrackNumber != "" {
+		and("o.track_number = %s", param(f.TrackNumber))
+	}
+	if f.DeliveryService != "" {
+		and("o.delivery_service = %s", param(f.DeliveryService))
+	}
+	if !f.CreatedFrom.IsZero() {
+		and("o.date_created >= %s", param(f.CreatedFrom))
+	}
+	if !f.CreatedTo.IsZero() {
+		and("o.date_created < %s", param(f.CreatedTo))
+	}
+	if !f.UpdatedSince.IsZero() {
+		and("o.updated_at >= %s", param(f.UpdatedSince))
+	}
+
+	var payment []string
+	if f.Currency != "" {
+		payment = append(payment, "pf.currency = "+param(f.Currency))
+	}
+	if f.Provider != "" {
+		payment = append(payment, "pf.provider = "+param(f.Provider))
+	}
+	if len(payment) > 0 {
+		and("EXISTS (SELECT 1 FROM payments pf WHERE pf.order_uid = o.order_uid AND %s)", strings.Join(payment, " AND "))
+	}
+
+	var item []string
+	if f.Brand != "" {
+		item = append(item, "itf.brand = "+param(f.Brand))
+	}
+	if f.NmID != 0 {
+		item = append(item, "itf.nm_id = "+param(f.NmID))
+	}
+	if len(item) > 0 {
+		and("EXISTS (SELECT 1 FROM items itf WHERE itf.order_uid = o.order_uid AND %s)", strings.Join(item, " AND "))
+	}
+
+	return sql.String()
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yokitheyo/wb_level0/internal/models"
+)
+
+// OrderIterator walks over the stored orders page by page, ordered by
+// order_uid, so that callers never hold more than one page in memory.
+type OrderIterator interface {
+	Next(ctx context.Context) bool
+	Orders() []models.Order
+	Err() error
+}
+
+type orderIterator struct {
+	repo      *orderRepository
+	filter    OrderFilter
+	batchSize int
+	after     string
+	orders    []models.Order
+	err       error
+	done      bool
+}
+
+func (r *orderRepository) IterateOrders(filter OrderFilter, batchSize int) OrderIterator {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	return &orderIterator{
+		repo:      r,
+		filter:    filter,
+		batchSize: batchSize,
+	}
+}
+
+func (it *orderIterator) Next(ctx context.Context) bool {
+	if it.done || it.err != nil {
+		return false
+	}
+
+	args := []interface{}{it.after}
+	query := selectOrdersQuery + `
+        WHERE o.order_uid > $1` + it.filter.conditions(&args)
+	args = append(args, it.batchSize)
+	query += fmt.Sprintf(`
+        ORDER BY o.order_uid
+        LIMIT $%d`, len(args))
+
+	orders, err := it.repo.queryOrders(ctx, it.repo.db, query, args...)
+	if err != nil {
+		it.err = err
+		return false
+	}
+
+	if len(orders) < it.batchSize {
+		it.done = true
+	}
+	if len(orders) == 0 {
+		return false
+	}
+
+	it.orders = orders
+	it.after = orders[len(orders)-1].OrderUID
+	return true
+}
+
+func (it *orderIterator) Orders() []models.Order {
+	return it.orders
+}
+
+func (it *orderIterator) Err() error {
+	return it.err
+}
@@ -2,18 +2,31 @@ package repository
 
 import (
 	"context"
-	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
+	"time"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/yokitheyo/wb_level0/internal/models"
 	"go.uber.org/zap"
 )
 
 type OrderRepository interface {
-	SaveOrder(ctx context.Context, order models.Order) error
+	SaveOrder(ctx context.Context, order models.Order) (SaveResult, error)
+	SaveOrders(ctx context.Context, orders []models.Order) ([]SaveResult, error)
+	GetOrderHistory(ctx context.Context, orderUID string) ([]models.OrderRevision, error)
+	ProcessedMessages(ctx context.Context, keys []string) (map[string]ProcessedMessage, error)
+	MarkProcessed(ctx context.Context, messages []ProcessedMessage) error
+	DeleteProcessedMessages(ctx context.Context, olderThan time.Duration) (int64, error)
 	GetOrderByID(ctx context.Context, orderUID string) (*models.Order, error)
-	GetAllOrders(ctx context.Context) ([]models.Order, error)
+	GetOrdersByIDs(ctx context.Context, orderUIDs []string) ([]models.Order, error)
+	IterateOrders(filter OrderFilter, batchSize int) OrderIterator
+	CountOrders(ctx context.Context, filter OrderFilter) (int, error)
+	SearchOrders(ctx context.Context, q OrderQuery) (OrderPage, error)
+	StreamOrders(ctx context.Context, filter OrderFilter, fn func(order models.Order) error) error
 }
 
 type orderRepository struct {
@@ -28,31 +41,58 @@ func NewOrderRepository(db *pgxpool.Pool, logger *zap.Logger) OrderRepository {
 	}
 }
 
-func (r *orderRepository) SaveOrder(ctx context.Context, order models.Order) error {
-	tx, err := r.db.Begin(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer func() {
-		if err != nil {
-			tx.Rollback(ctx)
-		}
-	}()
+type SaveStatus string
+
+const (
+	SaveCreated   SaveStatus = "created"
+	SaveUpdated   SaveStatus = "updated"
+	SaveUnchanged SaveStatus = "unchanged"
+	SaveStale     SaveStatus = "stale"
+)
+
+// SaveResult describes what happened to one order passed to SaveOrders.
+// Order is the state stored after the call, including its version.
+type SaveResult struct {
+	Status SaveStatus
+	Order  models.Order
+}
+
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
 
-	_, err = tx.Exec(ctx, `
+const (
+	insertOrderQuery = `
         INSERT INTO orders (
             order_uid, track_number, entry, locale, internal_signature,
-            customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
-        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-        ON CONFLICT (order_uid) DO NOTHING`,
-		order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature,
-		order.CustomerID, order.DeliveryService, order.ShardKey, order.SmID, order.DateCreated, order.OofShard,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to insert order: %w", err)
-	}
+            customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard,
+            version, updated_at
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+        ON CONFLICT (order_uid) DO NOTHING`
 
-	_, err = tx.Exec(ctx, `
+	updateOrderQuery = `
+        UPDATE orders SET
+            track_number = $2,
+            entry = $3,
+            locale = $4,
+            internal_signature = $5,
+            customer_id = $6,
+            delivery_service = $7,
+            shardkey = $8,
+            sm_id = $9,
+            date_created = $10,
+            oof_shard = $11,
+            version = $12,
+            updated_at = $13
+        WHERE order_uid = $1`
+
+	insertHistoryQuery = `
+        INSERT INTO order_history (order_uid, version, updated_at, replaced_at, data)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (order_uid, version) DO NOTHING`
+
+	upsertDeliveryQuery = `
         INSERT INTO deliveries (
             order_uid, name, phone, zip, city, address, region, email
         ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
@@ -63,15 +103,9 @@ func (r *orderRepository) SaveOrder(ctx context.Context, order models.Order) err
             city = EXCLUDED.city,
             address = EXCLUDED.address,
             region = EXCLUDED.region,
-            email = EXCLUDED.email`,
-		order.OrderUID, order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip,
-		order.Delivery.City, order.Delivery.Address, order.Delivery.Region, order.Delivery.Email,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to insert delivery: %w", err)
-	}
+            email = EXCLUDED.email`
 
-	_, err = tx.Exec(ctx, `
+	upsertPaymentQuery = `
         INSERT INTO payments (
             order_uid, transaction, request_id, currency, provider,
             amount, payment_dt, bank, delivery_cost, goods_total, custom_fee
@@ -86,146 +120,489 @@ func (r *orderRepository) SaveOrder(ctx context.Context, order models.Order) err
             bank = EXCLUDED.bank,
             delivery_cost = EXCLUDED.delivery_cost,
             goods_total = EXCLUDED.goods_total,
-            custom_fee = EXCLUDED.custom_fee`,
-		order.OrderUID, order.Payment.Transaction, order.Payment.RequestID, order.Payment.Currency,
-		order.Payment.Provider, order.Payment.Amount, order.Payment.PaymentDt, order.Payment.Bank,
-		order.Payment.DeliveryCost, order.Payment.GoodsTotal, order.Payment.CustomFee,
+            custom_fee = EXCLUDED.custom_fee`
+
+	deleteItemsQuery = `DELETE FROM items WHERE order_uid = $1`
+
+	insertItemQuery = `
+        INSERT INTO items (
+            order_uid, chrt_id, track_number, price, rid, name,
+            sale, size, total_price, nm_id, brand, status
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+        ON CONFLICT (order_uid, chrt_id, rid) DO UPDATE SET
+            track_number = EXCLUDED.track_number,
+            price = EXCLUDED.price,
+            name = EXCLUDED.name,
+            sale = EXCLUDED.sale,
+            size = EXCLUDED.size,
+            total_price = EXCLUDED.total_price,
+            nm_id = EXCLUDED.nm_id,
+            brand = EXCLUDED.brand,
+            status = EXCLUDED.status`
+)
+
+func (r *orderRepository) SaveOrder(ctx context.Context, order models.Order) (SaveResult, error) {
+	results, err := r.SaveOrders(ctx, []models.Order{order})
+	if err != nil {
+		return SaveResult{}, err
+	}
+	return results[0], nil
+}
+
+// SaveOrders writes all orders in a single transaction, sending every
+// statement to the server in one batch.
+//
+// An order that already exists is replaced only if its content changed.
+// When the incoming order carries a version, it must be newer than the
+// stored one or the order is reported as stale; without a version the
+// last writer wins and the stored version is incremented. Every replaced
+// state is kept in order_history.
+func (r *orderRepository) SaveOrders(ctx context.Context, orders []models.Order) ([]SaveResult, error) {
+	if len(orders) == 0 {
+		return nil, nil
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	current, err := r.lockExistingOrders(ctx, tx, orders)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	batch := &pgx.Batch{}
+	results := make([]SaveResult, len(orders))
+
+	for i, order := range orders {
+		existing, ok := current[order.OrderUID]
+		order.UpdatedAt = now
+		order.Items = uniqueItems(order.Items)
+
+		switch {
+		case !ok:
+			if order.Version <= 0 {
+				order.Version = 1
+			}
+			queueOrder(batch, insertOrderQuery, order)
+			results[i] = SaveResult{Status: SaveCreated, Order: order}
+		case order.Version > 0 && order.Version <= existing.Version:
+			results[i] = SaveResult{Status: SaveStale, Order: existing}
+			continue
+		case order.Version <= 0 && sameOrderContent(order, existing):
+			results[i] = SaveResult{Status: SaveUnchanged, Order: existing}
+			continue
+		default:
+			if order.Version <= 0 {
+				order.Version = existing.Version + 1
+			}
+			snapshot, err := json.Marshal(existing)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal order revision: %w", err)
+			}
+			batch.Queue(insertHistoryQuery,
+				existing.OrderUID, existing.Version, existing.UpdatedAt, now, snapshot,
+			)
+			batch.Queue(deleteItemsQuery, order.OrderUID)
+			queueOrder(batch, updateOrderQuery, order)
+			results[i] = SaveResult{Status: SaveUpdated, Order: order}
+		}
+
+		current[order.OrderUID] = order
+	}
+
+	if batch.Len() > 0 {
+		br := tx.SendBatch(ctx, batch)
+		for i := 0; i < batch.Len(); i++ {
+			if _, err := br.Exec(); err != nil {
+				br.Close()
+				return nil, fmt.Errorf("failed to write order: %w", err)
+			}
+		}
+		if err := br.Close(); err != nil {
+			return nil, fmt.Errorf("failed to close batch: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return results, nil
+}
+
+// orderLockSpace is the first key of the advisory locks taken on order IDs,
+// keeping them apart from other advisory locks in the database.
+const orderLockSpace = 0x6f726472 // "ordr"
+
+// lockExistingOrders locks every order ID for the rest of the transaction
+// and returns the current state of the orders that are already stored.
+//
+// Row locks alone cannot cover an order that does not exist yet: two
+// transactions would both find it missing and both try to create it, and
+// the loser's insert would be silently skipped. The advisory lock on the ID
+// makes the second transaction wait and then see the first one's order.
+// Locks are taken in hash order so that concurrent batches cannot deadlock.
+func (r *orderRepository) lockExistingOrders(ctx context.Context, tx pgx.Tx, orders []models.Order) (map[string]models.Order, error) {
+	uids := make([]string, len(orders))
+	for i, order := range orders {
+		uids[i] = order.OrderUID
+	}
+
+	if _, err := tx.Exec(ctx, `
+        SELECT pg_advisory_xact_lock($2, h)
+        FROM (
+            SELECT DISTINCT hashtext(uid) AS h
+            FROM unnest($1::varchar[]) AS u(uid)
+            ORDER BY h
+        ) AS ids`,
+		uids, int32(orderLockSpace),
+	); err != nil {
+		return nil, fmt.Errorf("failed to lock order IDs: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, `
+        SELECT order_uid FROM orders
+        WHERE order_uid = ANY($1)
+        ORDER BY order_uid
+        FOR UPDATE`,
+		uids,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to insert payment: %w", err)
+		return nil, fmt.Errorf("failed to lock orders: %w", err)
 	}
+	var existing []string
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan order ID: %w", err)
+		}
+		existing = append(existing, uid)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to lock orders: %w", err)
+	}
+
+	current := make(map[string]models.Order, len(existing))
+	if len(existing) == 0 {
+		return current, nil
+	}
+
+	stored, err := r.getOrders(ctx, tx, existing)
+	if err != nil {
+		return nil, err
+	}
+	for _, order := range stored {
+		current[order.OrderUID] = order
+	}
+	return current, nil
+}
 
+func queueOrder(batch *pgx.Batch, orderQuery string, order models.Order) {
+	batch.Queue(orderQuery,
+		order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature,
+		order.CustomerID, order.DeliveryService, order.ShardKey, order.SmID, order.DateCreated, order.OofShard,
+		order.Version, order.UpdatedAt,
+	)
+	batch.Queue(upsertDeliveryQuery,
+		order.OrderUID, order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip,
+		order.Delivery.City, order.Delivery.Address, order.Delivery.Region, order.Delivery.Email,
+	)
+	batch.Queue(upsertPaymentQuery,
+		order.OrderUID, order.Payment.Transaction, order.Payment.RequestID, order.Payment.Currency,
+		order.Payment.Provider, order.Payment.Amount, order.Payment.PaymentDt, order.Payment.Bank,
+		order.Payment.DeliveryCost, order.Payment.GoodsTotal, order.Payment.CustomFee,
+	)
 	for _, item := range order.Items {
-		_, err = tx.Exec(ctx, `
-            INSERT INTO items (
-                order_uid, chrt_id, track_number, price, rid, name,
-                sale, size, total_price, nm_id, brand, status
-            ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		batch.Queue(insertItemQuery,
 			order.OrderUID, item.ChrtID, item.TrackNumber, item.Price, item.RID, item.Name,
 			item.Sale, item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status,
 		)
-		if err != nil {
-			return fmt.Errorf("failed to insert item: %w", err)
+	}
+}
+
+// uniqueItems returns items with one entry per (chrt_id, rid), the key of
+// the items table. A repeated item keeps the position of its first entry and
+// the values of its last one, which is what the upsert stores; without this
+// a replayed order would never compare equal to its stored state.
+func uniqueItems(items []models.Item) []models.Item {
+	type itemKey struct {
+		chrtID int
+		rid    string
+	}
+	index := make(map[itemKey]int, len(items))
+	unique := make([]models.Item, 0, len(items))
+	for _, item := range items {
+		key := itemKey{item.ChrtID, item.RID}
+		if i, ok := index[key]; ok {
+			unique[i] = item
+			continue
+		}
+		index[key] = len(unique)
+		unique = append(unique, item)
+	}
+	if len(unique) == len(items) {
+		return items
+	}
+	return unique
+}
+
+// sameOrderContent compares two orders ignoring their version metadata.
+func sameOrderContent(a, b models.Order) bool {
+	if !a.DateCreated.Equal(b.DateCreated) {
+		return false
+	}
+	a.DateCreated, b.DateCreated = time.Time{}, time.Time{}
+	a.Version, b.Version = 0, 0
+	a.UpdatedAt, b.UpdatedAt = time.Time{}, time.Time{}
+	if len(a.Items) == 0 && len(b.Items) == 0 {
+		a.Items, b.Items = nil, nil
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// ProcessedMessages returns the messages among keys that were already
+// recorded by MarkProcessed, by key.
+func (r *orderRepository) ProcessedMessages(ctx context.Context, keys []string) (map[string]ProcessedMessage, error) {
+	processed := make(map[string]ProcessedMessage)
+	if len(keys) == 0 {
+		return processed, nil
+	}
+
+	rows, err := r.db.Query(ctx, `
+        SELECT message_key, COALESCE(schema_version, ''), COALESCE(payload_hash, '')
+        FROM processed_messages
+        WHERE message_key = ANY($1)`,
+		keys,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query processed messages: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m ProcessedMessage
+		if err := rows.Scan(&m.Key, &m.SchemaVersion, &m.PayloadHash); err != nil {
+			return nil, fmt.Errorf("failed to scan message key: %w", err)
 		}
+		processed[m.Key] = m
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read processed messages: %w", err)
 	}
+	return processed, nil
+}
+
+// ProcessedMessage is a message key recorded by MarkProcessed, with the
+// schema version its producer declared, if any. PayloadHash is set for
+// client-chosen keys, so that reusing one for another payload is detected.
+type ProcessedMessage struct {
+	Key           string
+	SchemaVersion string
+	PayloadHash   string
+}
 
-	if err = tx.Commit(ctx); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+func (r *orderRepository) MarkProcessed(ctx context.Context, messages []ProcessedMessage) error {
+	if len(messages) == 0 {
+		return nil
 	}
 
+	keys := make([]string, len(messages))
+	versions := make([]string, len(messages))
+	hashes := make([]string, len(messages))
+	for i, m := range messages {
+		keys[i] = m.Key
+		versions[i] = m.SchemaVersion
+		hashes[i] = m.PayloadHash
+	}
+
+	_, err := r.db.Exec(ctx, `
+        INSERT INTO processed_messages (message_key, schema_version, payload_hash)
+        SELECT key, NULLIF(version, ''), NULLIF(hash, '')
+        FROM unnest($1::varchar[], $2::varchar[], $3::varchar[]) AS m(key, version, hash)
+        ON CONFLICT (message_key) DO NOTHING`,
+		keys, versions, hashes,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark messages as processed: %w", err)
+	}
 	return nil
 }
 
-func (r *orderRepository) GetOrderByID(ctx context.Context, orderUID string) (*models.Order, error) {
-	var order models.Order
-	var delivery models.Delivery
-	var payment models.Payment
+// DeleteProcessedMessages removes the message keys recorded more than
+// olderThan ago and returns how many were removed.
+func (r *orderRepository) DeleteProcessedMessages(ctx context.Context, olderThan time.Duration) (int64, error) {
+	tag, err := r.db.Exec(ctx, `
+        DELETE FROM processed_messages
+        WHERE processed_at < NOW() - $1::interval`,
+		olderThan,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete processed messages: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
 
-	err := r.db.QueryRow(ctx, `
-        SELECT 
-            o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature,
-            o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard
+// selectOrdersQuery reads whole orders in one round trip: delivery and
+// payment are joined and items are aggregated into a JSON array per order.
+const selectOrdersQuery = `
+        SELECT
+            o.order_uid, o.track_number, o.entry, o.locale, COALESCE(o.internal_signature, ''),
+            o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard,
+            o.version, o.updated_at,
+            COALESCE(d.name, ''), COALESCE(d.phone, ''), COALESCE(d.zip, ''), COALESCE(d.city, ''),
+            COALESCE(d.address, ''), COALESCE(d.region, ''), COALESCE(d.email, ''),
+            COALESCE(p.transaction, ''), COALESCE(p.request_id, ''), COALESCE(p.currency, ''),
+            COALESCE(p.provider, ''), COALESCE(p.amount, 0), COALESCE(p.payment_dt, 0),
+            COALESCE(p.bank, ''), COALESCE(p.delivery_cost, 0), COALESCE(p.goods_total, 0),
+            COALESCE(p.custom_fee, 0),
+            COALESCE(i.items, '[]')
         FROM orders o
-        WHERE o.order_uid = $1`,
-		orderUID,
-	).Scan(
+        LEFT JOIN deliveries d ON d.order_uid = o.order_uid
+        LEFT JOIN payments p ON p.order_uid = o.order_uid
+        LEFT JOIN LATERAL (
+            SELECT json_agg(json_build_object(
+                'chrt_id', it.chrt_id,
+                'track_number', it.track_number,
+                'price', it.price,
+                'rid', it.rid,
+                'name', it.name,
+                'sale', it.sale,
+                'size', it.size,
+                'total_price', it.total_price,
+                'nm_id', it.nm_id,
+                'brand', it.brand,
+                'status', it.status
+            ) ORDER BY it.id) AS items
+            FROM items it
+            WHERE it.order_uid = o.order_uid
+        ) i ON true`
+
+func scanOrder(row pgx.Row) (models.Order, error) {
+	var order models.Order
+	var items []byte
+
+	err := row.Scan(
 		&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale, &order.InternalSignature,
 		&order.CustomerID, &order.DeliveryService, &order.ShardKey, &order.SmID, &order.DateCreated, &order.OofShard,
+		&order.Version, &order.UpdatedAt,
+		&order.Delivery.Name, &order.Delivery.Phone, &order.Delivery.Zip, &order.Delivery.City,
+		&order.Delivery.Address, &order.Delivery.Region, &order.Delivery.Email,
+		&order.Payment.Transaction, &order.Payment.RequestID, &order.Payment.Currency,
+		&order.Payment.Provider, &order.Payment.Amount, &order.Payment.PaymentDt,
+		&order.Payment.Bank, &order.Payment.DeliveryCost, &order.Payment.GoodsTotal,
+		&order.Payment.CustomFee,
+		&items,
 	)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		return order, err
+	}
+
+	if err := json.Unmarshal(items, &order.Items); err != nil {
+		return order, fmt.Errorf("failed to unmarshal items: %w", err)
+	}
+	if len(order.Items) == 0 {
+		order.Items = nil
+	}
+	return order, nil
+}
+
+func (r *orderRepository) GetOrderByID(ctx context.Context, orderUID string) (*models.Order, error) {
+	order, err := scanOrder(r.db.QueryRow(ctx, selectOrdersQuery+`
+        WHERE o.order_uid = $1`,
+		orderUID,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, fmt.Errorf("failed to get order: %w", err)
 	}
+	return &order, nil
+}
 
-	err = r.db.QueryRow(ctx, `
-        SELECT 
-            name, phone, zip, city, address, region, email
-        FROM deliveries
-        WHERE order_uid = $1`,
-		orderUID,
-	).Scan(
-		&delivery.Name, &delivery.Phone, &delivery.Zip, &delivery.City,
-		&delivery.Address, &delivery.Region, &delivery.Email,
-	)
-	if err != nil && err != sql.ErrNoRows {
-		return nil, fmt.Errorf("failed to get delivery: %w", err)
+// GetOrdersByIDs returns the stored orders among orderUIDs; unknown UIDs are
+// left out.
+func (r *orderRepository) GetOrdersByIDs(ctx context.Context, orderUIDs []string) ([]models.Order, error) {
+	if len(orderUIDs) == 0 {
+		return nil, nil
 	}
-	order.Delivery = delivery
+	return r.getOrders(ctx, r.db, orderUIDs)
+}
 
-	err = r.db.QueryRow(ctx, `
-        SELECT 
-            transaction, request_id, currency, provider, amount,
-            payment_dt, bank, delivery_cost, goods_total, custom_fee
-        FROM payments
-        WHERE order_uid = $1`,
-		orderUID,
-	).Scan(
-		&payment.Transaction, &payment.RequestID, &payment.Currency, &payment.Provider, &payment.Amount,
-		&payment.PaymentDt, &payment.Bank, &payment.DeliveryCost, &payment.GoodsTotal, &payment.CustomFee,
-	)
-	if err != nil && err != sql.ErrNoRows {
-		return nil, fmt.Errorf("failed to get payment: %w", err)
+func (r *orderRepository) CountOrders(ctx context.Context, filter OrderFilter) (int, error) {
+	args := []interface{}{}
+	query := `
+        SELECT count(*) FROM orders o
+        WHERE TRUE` + filter.conditions(&args)
+
+	var count int
+	if err := r.db.QueryRow(ctx, query, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count orders: %w", err)
 	}
-	order.Payment = payment
+	return count, nil
+}
 
-	rows, err := r.db.Query(ctx, `
-        SELECT 
-            chrt_id, track_number, price, rid, name, sale,
-            size, total_price, nm_id, brand, status
-        FROM items
-        WHERE order_uid = $1`,
-		orderUID,
+func (r *orderRepository) getOrders(ctx context.Context, q querier, orderUIDs []string) ([]models.Order, error) {
+	return r.queryOrders(ctx, q, selectOrdersQuery+`
+        WHERE o.order_uid = ANY($1)`,
+		orderUIDs,
 	)
+}
+
+func (r *orderRepository) queryOrders(ctx context.Context, q querier, query string, args ...interface{}) ([]models.Order, error) {
+	rows, err := q.Query(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query items: %w", err)
+		return nil, fmt.Errorf("failed to query orders: %w", err)
 	}
 	defer rows.Close()
 
-	var items []models.Item
+	var orders []models.Order
 	for rows.Next() {
-		var item models.Item
-		if err := rows.Scan(
-			&item.ChrtID, &item.TrackNumber, &item.Price, &item.RID, &item.Name, &item.Sale,
-			&item.Size, &item.TotalPrice, &item.NmID, &item.Brand, &item.Status,
-		); err != nil {
-			return nil, fmt.Errorf("failed to scan item: %w", err)
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
 		}
-		items = append(items, item)
+		orders = append(orders, order)
 	}
-	order.Items = items
-
-	return &order, nil
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read orders: %w", err)
+	}
+	return orders, nil
 }
 
-func (r *orderRepository) GetAllOrders(ctx context.Context) ([]models.Order, error) {
-	rows, err := r.db.Query(ctx, "SELECT order_uid FROM orders")
+func (r *orderRepository) GetOrderHistory(ctx context.Context, orderUID string) ([]models.OrderRevision, error) {
+	rows, err := r.db.Query(ctx, `
+        SELECT version, updated_at, replaced_at, data
+        FROM order_history
+        WHERE order_uid = $1
+        ORDER BY version`,
+		orderUID,
+	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query orders: %w", err)
+		return nil, fmt.Errorf("failed to query order history: %w", err)
 	}
 	defer rows.Close()
 
-	var orderIDs []string
+	revisions := []models.OrderRevision{}
 	for rows.Next() {
-		var id string
-		if err := rows.Scan(&id); err != nil {
-			return nil, fmt.Errorf("failed to scan order ID: %w", err)
+		var revision models.OrderRevision
+		var data []byte
+		if err := rows.Scan(&revision.Version, &revision.UpdatedAt, &revision.ReplacedAt, &data); err != nil {
+			return nil, fmt.Errorf("failed to scan order revision: %w", err)
 		}
-		orderIDs = append(orderIDs, id)
-	}
-
-	var orders []models.Order
-	for _, id := range orderIDs {
-		order, err := r.GetOrderByID(ctx, id)
-		if err != nil {
-			r.logger.Error("failed to get order by ID", zap.String("order_uid", id), zap.Error(err))
-			continue
-		}
-		if order != nil {
-			orders = append(orders, *order)
+		if err := json.Unmarshal(data, &revision.Order); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal order revision: %w", err)
 		}
+		revisions = append(revisions, revision)
 	}
-
-	return orders, nil
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read order history: %w", err)
+	}
+	return revisions, nil
 }
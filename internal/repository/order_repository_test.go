@@ -0,0 +1,315 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/yokitheyo/wb_level0/internal/models"
+	"go.uber.org/zap"
+)
+
+// newTestRepository returns a repository on a schema of its own in the
+// database at TEST_DATABASE_URL, with every migration applied. The schema
+// is dropped when the test ends. Without TEST_DATABASE_URL the test is
+// skipped.
+func newTestRepository(t *testing.T) (*orderRepository, *pgxpool.Pool) {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+
+	admin, err := pgxpool.Connect(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(admin.Close)
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+			t.Errorf("failed to drop schema %s: %v", schema, err)
+		}
+	})
+
+	cfg, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.ConnConfig.RuntimeParams["search_path"] = schema
+	pool, err := pgxpool.ConnectConfig(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	files, err := filepath.Glob("../../migrations/*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		sql, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pool.Exec(ctx, string(sql)); err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+	}
+
+	return &orderRepository{db: pool, logger: zap.NewNop()}, pool
+}
+
+func testOrder(uid string) models.Order {
+	item := func(chrtID int, rid string) models.Item {
+		return models.Item{
+			ChrtID: chrtID, TrackNumber: "WBILMTESTTRACK", Price: 453, RID: rid, Name: "Mascaras",
+			Sale: 30, Size: "0", TotalPrice: 317, NmID: 2389212, Brand: "Vivienne Sabo", Status: 202,
+		}
+	}
+	return models.Order{
+		OrderUID: uid, TrackNumber: "WBILMTESTTRACK", Entry: "WBIL", Locale: "en",
+		CustomerID: "test", DeliveryService: "meest", ShardKey: "9", SmID: 99, OofShard: "1",
+		DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+		Delivery: models.Delivery{
+			Name: "Test Testov", Phone: "+9720000000", Zip: "2639809", City: "Kiryat Mozkin",
+			Address: "Ploshad Mira 15", Region: "Kraiot", Email: "test@gmail.com",
+		},
+		Payment: models.Payment{
+			Transaction: uid, Currency: "USD", Provider: "wbpay", Amount: 1817,
+			PaymentDt: 1637907727, Bank: "alpha", DeliveryCost: 1500, GoodsTotal: 317,
+		},
+		Items: []models.Item{item(9934930, "ab4219087a764ae0btest"), item(9934931, "ab4219087a764ae0btest")},
+	}
+}
+
+// tableState is everything stored for one order, row by row.
+type tableState struct {
+	Orders, Deliveries, Payments, Items, History []string
+}
+
+func readState(t *testing.T, pool *pgxpool.Pool, uid string) tableState {
+	t.Helper()
+	rows := func(query string) []string {
+		r, err := pool.Query(context.Background(), query, uid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		var out []string
+		for r.Next() {
+			values, err := r.Values()
+			if err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, fmt.Sprint(values...))
+		}
+		if err := r.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	return tableState{
+		Orders:     rows(`SELECT order_uid, track_number, version, updated_at FROM orders WHERE order_uid = $1`),
+		Deliveries: rows(`SELECT * FROM deliveries WHERE order_uid = $1`),
+		Payments:   rows(`SELECT * FROM payments WHERE order_uid = $1`),
+		Items:      rows(`SELECT id, chrt_id, rid, price, total_price FROM items WHERE order_uid = $1 ORDER BY id`),
+		History:    rows(`SELECT version, updated_at FROM order_history WHERE order_uid = $1 ORDER BY version`),
+	}
+}
+
+// TestSaveOrdersReplay replays the message of an order whose MarkProcessed
+// failed, as the consumer does after a restart, and checks that no replay
+// changes what is stored.
+func TestSaveOrdersReplay(t *testing.T) {
+	repo, pool := newTestRepository(t)
+	ctx := context.Background()
+	const replays = 5
+
+	duplicated := testOrder("replay-duplicated-item")
+	// the same item twice takes the ON CONFLICT (order_uid, chrt_id, rid) path
+	duplicated.Items = append(duplicated.Items, duplicated.Items[0])
+	duplicated.Items[2].Price = 500
+
+	versioned := testOrder("replay-versioned")
+	versioned.Version = 3
+
+	for _, order := range []models.Order{testOrder("replay-plain"), duplicated, versioned} {
+		t.Run(order.OrderUID, func(t *testing.T) {
+			key := "message-" + order.OrderUID
+
+			results, err := repo.SaveOrders(ctx, []models.Order{order})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if results[0].Status != SaveCreated {
+				t.Fatalf("status = %s, want %s", results[0].Status, SaveCreated)
+			}
+
+			cancelled, cancel := context.WithCancel(ctx)
+			cancel()
+			if err := repo.MarkProcessed(cancelled, []ProcessedMessage{{Key: key}}); err == nil {
+				t.Fatal("MarkProcessed() with a cancelled context succeeded")
+			}
+
+			want := readState(t, pool, order.OrderUID)
+			if len(want.Items) != 2 || len(want.History) != 0 || len(want.Orders) != 1 {
+				t.Fatalf("stored %d orders, %d items and %d revisions, want 1, 2 and 0", len(want.Orders), len(want.Items), len(want.History))
+			}
+
+			for i := 0; i < replays; i++ {
+				processed, err := repo.ProcessedMessages(ctx, []string{key})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, ok := processed[key]; ok {
+					t.Fatal("message is recorded as processed, want it replayed")
+				}
+
+				results, err := repo.SaveOrders(ctx, []models.Order{order})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if s := results[0].Status; s != SaveUnchanged && s != SaveStale {
+					t.Fatalf("replay %d: status = %s, want unchanged or stale", i, s)
+				}
+				if got := readState(t, pool, order.OrderUID); !reflect.DeepEqual(got, want) {
+					t.Fatalf("replay %d changed the stored order:\ngot  %+v\nwant %+v", i, got, want)
+				}
+			}
+
+			if err := repo.MarkProcessed(ctx, []ProcessedMessage{{Key: key}}); err != nil {
+				t.Fatal(err)
+			}
+			processed, err := repo.ProcessedMessages(ctx, []string{key})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := processed[key]; !ok {
+				t.Fatal("message is not recorded as processed")
+			}
+		})
+	}
+}
+
+// TestSaveOrdersReplayedUpdate replays an update: the items are replaced
+// once and the replaced state is kept once in order_history.
+func TestSaveOrdersReplayedUpdate(t *testing.T) {
+	repo, pool := newTestRepository(t)
+	ctx := context.Background()
+
+	order := testOrder("replay-update")
+	if _, err := repo.SaveOrders(ctx, []models.Order{order}); err != nil {
+		t.Fatal(err)
+	}
+
+	update := order
+	update.Items = append([]models.Item{}, order.Items[1:]...)
+	update.Items[0].Price = 600
+	update.Version = 2
+
+	if _, err := repo.SaveOrders(ctx, []models.Order{update}); err != nil {
+		t.Fatal(err)
+	}
+	want := readState(t, pool, order.OrderUID)
+	if len(want.Items) != 1 || len(want.History) != 1 {
+		t.Fatalf("stored %d items and %d revisions, want 1 and 1", len(want.Items), len(want.History))
+	}
+
+	for i := 0; i < 3; i++ {
+		results, err := repo.SaveOrders(ctx, []models.Order{update})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if results[0].Status != SaveStale {
+			t.Fatalf("replay %d: status = %s, want %s", i, results[0].Status, SaveStale)
+		}
+		if got := readState(t, pool, order.OrderUID); !reflect.DeepEqual(got, want) {
+			t.Fatalf("replay %d changed the stored order:\ngot  %+v\nwant %+v", i, got, want)
+		}
+	}
+}
+
+func TestDeleteProcessedMessages(t *testing.T) {
+	repo, pool := newTestRepository(t)
+	ctx := context.Background()
+
+	messages := []ProcessedMessage{{Key: "old"}, {Key: "recent", SchemaVersion: "1"}, {Key: "new", PayloadHash: "hash"}}
+	if err := repo.MarkProcessed(ctx, messages); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Exec(ctx, `
+        UPDATE processed_messages SET processed_at = NOW() - CASE message_key
+            WHEN 'old' THEN INTERVAL '3 hours'
+            WHEN 'recent' THEN INTERVAL '30 minutes'
+            ELSE INTERVAL '0'
+        END`,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := repo.DeleteProcessedMessages(ctx, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 {
+		t.Errorf("deleted %d keys, want 1", deleted)
+	}
+
+	processed, err := repo.ProcessedMessages(ctx, []string{"old", "recent", "new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]ProcessedMessage{
+		"recent": {Key: "recent", SchemaVersion: "1"},
+		"new":    {Key: "new", PayloadHash: "hash"},
+	}
+	if !reflect.DeepEqual(processed, want) {
+		t.Errorf("processed = %+v, want %+v", processed, want)
+	}
+
+	// a key deleted by the retention is processed again when redelivered
+	if err := repo.MarkProcessed(ctx, []ProcessedMessage{{Key: "old"}}); err != nil {
+		t.Fatal(err)
+	}
+	if deleted, err := repo.DeleteProcessedMessages(ctx, time.Hour); err != nil || deleted != 0 {
+		t.Errorf("DeleteProcessedMessages() = %d, %v, want 0, nil", deleted, err)
+	}
+}
+
+func TestUniqueItems(t *testing.T) {
+	a := models.Item{ChrtID: 1, RID: "a", Price: 100}
+	b := models.Item{ChrtID: 2, RID: "a", Price: 200}
+	c := models.Item{ChrtID: 1, RID: "c", Price: 300}
+	a2 := models.Item{ChrtID: 1, RID: "a", Price: 400}
+
+	tests := []struct {
+		name  string
+		items []models.Item
+		want  []models.Item
+	}{
+		{"none", nil, nil},
+		{"unique", []models.Item{a, b, c}, []models.Item{a, b, c}},
+		{"repeated", []models.Item{a, b, a2, c, a}, []models.Item{a, b, c}},
+		{"last values win", []models.Item{a, b, a2}, []models.Item{a2, b}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := uniqueItems(tt.items); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("uniqueItems() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yokitheyo/wb_level0/internal/models"
+)
+
+const (
+	DefaultSearchLimit = 50
+	MaxSearchLimit     = 500
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type SortOrder string
+
+const (
+	SortNewestFirst SortOrder = "desc"
+	SortOldestFirst SortOrder = "asc"
+)
+
+// OrderQuery selects one page of orders sorted by date_created, with
+// order_uid breaking ties.
+type OrderQuery struct {
+	Filter OrderFilter
+	Sort   SortOrder
+	Limit  int
+	// Cursor is the NextCursor of the previous page, empty for the first.
+	Cursor string
+}
+
+type OrderPage struct {
+	Orders []models.Order `json:"orders"`
+	// NextCursor is empty on the last page.
+	NextCursor string `json:"next_cursor"`
+}
+
+// orderCursor is the sort key of the last order on a page. It is handed to
+// clients base64-encoded and opaque.
+type orderCursor struct {
+	dateCreated time.Time
+	orderUID    string
+}
+
+func (c orderCursor) encode() string {
+	raw := c.dateCreated.UTC().Format(time.RFC3339Nano) + "|" + c.orderUID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeOrderCursor(s string) (orderCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return orderCursor{}, ErrInvalidCursor
+	}
+	date, uid, ok := strings.Cut(string(raw), "|")
+	if !ok || uid == "" {
+		return orderCursor{}, ErrInvalidCursor
+	}
+	dateCreated, err := time.Parse(time.RFC3339Nano, date)
+	if err != nil {
+		return orderCursor{}, ErrInvalidCursor
+	}
+	return orderCursor{dateCreated: dateCreated, orderUID: uid}, nil
+}
+
+// SearchOrders returns the page of orders matching q. Pages are keyset
+// paginated on (date_created, order_uid), so later pages cost the same as
+// the first and orders inserted meanwhile do not shift them.
+func (r *orderRepository) SearchOrders(ctx context.Context, q OrderQuery) (OrderPage, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	direction, cmp := "DESC", "<"
+	if q.Sort == SortOldestFirst {
+		direction, cmp = "ASC", ">"
+	}
+
+	var args []interface{}
+	query := selectOrdersQuery + `
+        WHERE true` + q.Filter.conditions(&args)
+
+	if q.Cursor != "" {
+		cursor, err := decodeOrderCursor(q.Cursor)
+		if err != nil {
+			return OrderPage{}, err
+		}
+		args = append(args, cursor.dateCreated, cursor.orderUID)
+		query += fmt.Sprintf(`
+          AND (o.date_created, o.order_uid) %s ($%d, $%d)`, cmp, len(args)-1, len(args))
+	}
+
+	// one extra row tells whether there is a next page
+	args = append(args, limit+1)
+	query += fmt.Sprintf(`
+        ORDER BY o.date_created %[1]s, o.order_uid %[1]s
+        LIMIT $%[2]d`, direction, len(args))
+
+	orders, err := r.queryOrders(ctx, r.db, query, args...)
+	if err != nil {
+		return OrderPage{}, fmt.Errorf("failed to search orders: %w", err)
+	}
+
+	page := OrderPage{Orders: orders}
+	if len(orders) > limit {
+		page.Orders = orders[:limit]
+		last := page.Orders[limit-1]
+		page.NextCursor = orderCursor{dateCreated: last.DateCreated, orderUID: last.OrderUID}.encode()
+	}
+	if page.Orders == nil {
+		page.Orders = []models.Order{}
+	}
+	return page, nil
+}
+
+// StreamOrders calls fn for every order matching filter, oldest first, as
+// rows arrive from the database, so exports never hold more than one order
+// in memory. Iteration stops at the first error returned by fn.
+func (r *orderRepository) StreamOrders(ctx context.Context, filter OrderFilter, fn func(order models.Order) error) error {
+	var args []interface{}
+	query := selectOrdersQuery + `
+        WHERE true` + filter.conditions(&args) + `
+        ORDER BY o.date_created, o.order_uid`
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query orders: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan order: %w", err)
+		}
+		if err := fn(order); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read orders: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/jackc/pgconn"
+	"github.com/yokitheyo/wb_level0/internal/validator"
+)
+
+// ErrInvalidOrder marks orders that can never be processed successfully,
+// no matter how many times the message is redelivered.
+var ErrInvalidOrder = errors.New("invalid order")
+
+// ErrRestoreInProgress is returned when a cache restore is requested while
+// another one is still running.
+var ErrRestoreInProgress = errors.New("cache restore already in progress")
+
+// ErrVerificationInProgress is returned when a cache verification is
+// requested while another one is still running.
+var ErrVerificationInProgress = errors.New("cache verification already in progress")
+
+type Stage string
+
+const (
+	StageUnmarshal Stage = "unmarshal"
+	StageValidate  Stage = "validate"
+	StagePersist   Stage = "persist"
+)
+
+// ProcessError reports the pipeline stage at which an order failed and
+// whether retrying the same message may succeed.
+type ProcessError struct {
+	Stage     Stage
+	Retryable bool
+	Err       error
+}
+
+func (e *ProcessError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ProcessError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ProcessError) Is(target error) bool {
+	return target == ErrInvalidOrder && e.Stage != StagePersist
+}
+
+// StageOf returns the stage recorded in err, or an empty Stage if err does
+// not carry one.
+func StageOf(err error) Stage {
+	var pe *ProcessError
+	if errors.As(err, &pe) {
+		return pe.Stage
+	}
+	return ""
+}
+
+// IsRetryable reports whether err is transient. Errors that were not
+// classified by the service are treated as retryable so that messages are
+// never dropped by mistake.
+func IsRetryable(err error) bool {
+	var pe *ProcessError
+	if errors.As(err, &pe) {
+		return pe.Retryable
+	}
+	return err != nil
+}
+
+// ViolationsOf returns the validation violations carried by err, if any.
+func ViolationsOf(err error) validator.Violations {
+	var vs validator.Violations
+	if errors.As(err, &vs) {
+		return vs
+	}
+	return nil
+}
+
+func persistError(err error) *ProcessError {
+	return &ProcessError{Stage: StagePersist, Retryable: isTransientStorageError(err), Err: err}
+}
+
+// isTransientStorageError treats only failures to reach or use the database
+// as transient: network errors, timeouts, cancellations, errors pgconn marks
+// safe to retry and Postgres connection, rollback, resource and operator
+// errors. Everything else, including values pgx cannot encode, is permanent
+// and would fail again on every retry.
+func isTransientStorageError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code[:2] {
+		case "08", // connection exception
+			"40", // transaction rollback: serialization failure, deadlock
+			"53", // insufficient resources
+			"57": // operator intervention: admin shutdown, cannot connect now
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return pgconn.SafeToRetry(err) || pgconn.Timeout(err)
+}
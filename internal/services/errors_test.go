@@ -0,0 +1,42 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgtype"
+)
+
+func TestIsTransientStorageError(t *testing.T) {
+	var chrtID pgtype.Int4
+	encodeErr := chrtID.Set(int64(1) << 31)
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"encode error", encodeErr, false},
+		{"plain error", errors.New("unexpected"), false},
+		{"value too long", &pgconn.PgError{Code: "22001"}, false},
+		{"unique violation", &pgconn.PgError{Code: "23505"}, false},
+		{"connection failure", &pgconn.PgError{Code: "08006"}, true},
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, true},
+		{"too many connections", &pgconn.PgError{Code: "53300"}, true},
+		{"admin shutdown", &pgconn.PgError{Code: "57P01"}, true},
+		{"network error", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"deadline", context.DeadlineExceeded, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := fmt.Errorf("failed to save orders: %w", tt.err)
+			if got := isTransientStorageError(err); got != tt.want {
+				t.Fatalf("isTransientStorageError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"sync"
+
+	"github.com/yokitheyo/wb_level0/internal/cache"
+	"github.com/yokitheyo/wb_level0/internal/models"
+	"github.com/yokitheyo/wb_level0/internal/repository"
+	"github.com/yokitheyo/wb_level0/internal/validator"
+	"go.uber.org/zap"
+)
+
+// fakeRepository keeps orders and processed message keys in memory and counts
+// the calls the service makes.
+type fakeRepository struct {
+	repository.OrderRepository
+
+	mu        sync.Mutex
+	orders    map[string]models.Order
+	processed map[string]repository.ProcessedMessage
+	saveCalls int
+	// saveErr, if set, is consulted before every SaveOrders call
+	saveErr func(orders []models.Order) error
+}
+
+func newFakeRepository() *fakeRepository {
+	return &fakeRepository{
+		orders:    make(map[string]models.Order),
+		processed: make(map[string]repository.ProcessedMessage),
+	}
+}
+
+func (r *fakeRepository) SaveOrders(_ context.Context, orders []models.Order) ([]repository.SaveResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.saveCalls++
+	if r.saveErr != nil {
+		if err := r.saveErr(orders); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]repository.SaveResult, len(orders))
+	for i, order := range orders {
+		status := repository.SaveCreated
+		if stored, ok := r.orders[order.OrderUID]; ok {
+			status = repository.SaveUpdated
+			order.Version = stored.Version
+		}
+		order.Version++
+		r.orders[order.OrderUID] = order
+		results[i] = repository.SaveResult{Status: status, Order: order}
+	}
+	return results, nil
+}
+
+func (r *fakeRepository) ProcessedMessages(_ context.Context, keys []string) (map[string]repository.ProcessedMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	processed := make(map[string]repository.ProcessedMessage)
+	for _, key := range keys {
+		if m, ok := r.processed[key]; ok {
+			processed[key] = m
+		}
+	}
+	return processed, nil
+}
+
+func (r *fakeRepository) MarkProcessed(_ context.Context, messages []repository.ProcessedMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, m := range messages {
+		r.processed[m.Key] = m
+	}
+	return nil
+}
+
+func (r *fakeRepository) saved() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.saveCalls
+}
+
+func newTestService(repo repository.OrderRepository) *orderService {
+	logger := zap.NewNop()
+	return NewOrderService(repo,
+		cache.NewOrderCache(logger),
+		cache.NewNegativeCache(0),
+		validator.NewLenientDecoder(),
+		validator.New(),
+		logger,
+	).(*orderService)
+}
@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yokitheyo/wb_level0/internal/models"
+	"github.com/yokitheyo/wb_level0/internal/repository"
+	"github.com/yokitheyo/wb_level0/internal/validator"
+	"go.uber.org/zap"
+)
+
+type IngestStatus string
+
+const (
+	IngestCreated   IngestStatus = "created"
+	IngestUpdated   IngestStatus = "updated"
+	IngestUnchanged IngestStatus = "unchanged"
+	// IngestStale is an order older than the stored version; it is ignored.
+	IngestStale IngestStatus = "stale"
+	// IngestDuplicate is a message that was already processed.
+	IngestDuplicate IngestStatus = "duplicate"
+	// IngestConflict is a message whose idempotency key was already used
+	// for a different payload; it is ignored.
+	IngestConflict IngestStatus = "conflict"
+	IngestInvalid  IngestStatus = "invalid"
+	// IngestFailed is a valid order that could not be saved.
+	IngestFailed IngestStatus = "failed"
+)
+
+// MaxSchemaVersionLength is the longest schema version that is recorded.
+const MaxSchemaVersionLength = 64
+
+// idempotencyKeyPrefix keeps client-chosen keys apart from content hashes in
+// the processed messages table.
+const idempotencyKeyPrefix = "idempotency:"
+
+// Message is one order payload as received from a producer.
+type Message struct {
+	Data []byte
+	// IdempotencyKey, if set, identifies the submission instead of the
+	// payload's content hash, so retrying it is reported as a duplicate and
+	// reusing it for another payload as a conflict.
+	IdempotencyKey string
+	// SchemaVersion is the version of the order contract the producer
+	// declared, recorded with the processed message.
+	SchemaVersion string
+}
+
+// IngestResult describes what happened to one submitted order.
+type IngestResult struct {
+	OrderUID string       `json:"order_uid,omitempty"`
+	Status   IngestStatus `json:"status"`
+	Version  int          `json:"version,omitempty"`
+	Stage    Stage        `json:"stage,omitempty"`
+	Reason   string       `json:"reason,omitempty"`
+	// Violations lists every failed validation rule of an invalid order.
+	Violations validator.Violations `json:"violations,omitempty"`
+	// Warnings lists the failed rules that are configured to only warn.
+	Warnings validator.Violations `json:"warnings,omitempty"`
+	err      error
+}
+
+func failedResult(orderUID string, err error) IngestResult {
+	return IngestResult{
+		OrderUID: orderUID,
+		Status:   IngestFailed,
+		Stage:    StageOf(err),
+		Reason:   err.Error(),
+		err:      err,
+	}
+}
+
+// IngestOrder processes one order like a Kafka message. The error is only
+// set if the order could not be saved.
+func (s *orderService) IngestOrder(ctx context.Context, msg Message) (IngestResult, error) {
+	results, err := s.IngestOrders(ctx, []Message{msg})
+	return results[0], err
+}
+
+// IngestOrders decodes and validates every order and saves the valid ones in
+// one transaction. The error is set if saving failed transiently, in which
+// case the valid orders are reported as failed; orders that fail for a
+// permanent reason are reported as failed one by one.
+func (s *orderService) IngestOrders(ctx context.Context, msgs []Message) ([]IngestResult, error) {
+	results := make([]IngestResult, len(msgs))
+	decoded := make(map[int]models.Order, len(msgs))
+	keys := make([]string, len(msgs))
+	hashes := make([]string, len(msgs))
+	warnings := make([]validator.Violations, len(msgs))
+
+	for i, msg := range msgs {
+		order, orderWarnings, err := s.decodeOrder(msg)
+		warnings[i] = orderWarnings
+		if err != nil {
+			results[i] = IngestResult{
+				OrderUID:   order.OrderUID,
+				Status:     IngestInvalid,
+				Stage:      StageOf(err),
+				Reason:     err.Error(),
+				Violations: ViolationsOf(err),
+				err:        err,
+			}
+			continue
+		}
+		decoded[i] = order
+		keys[i] = messageKey(msg.Data)
+		if msg.IdempotencyKey != "" {
+			hashes[i] = keys[i]
+			keys[i] = idempotencyKeyPrefix + msg.IdempotencyKey
+		}
+	}
+
+	candidates := make([]string, 0, len(decoded))
+	for i := range decoded {
+		candidates = append(candidates, keys[i])
+	}
+	processed, err := s.repo.ProcessedMessages(ctx, candidates)
+	if err != nil {
+		s.logger.Error("failed to check processed messages", zap.Error(err))
+		perr := persistError(fmt.Errorf("failed to check processed messages: %w", err))
+		for i, order := range decoded {
+			results[i] = failedResult(order.OrderUID, perr)
+		}
+		return withWarnings(results, warnings), perr
+	}
+
+	orders := make([]models.Order, 0, len(decoded))
+	indexes := make([]int, 0, len(decoded))
+	saved := make([]repository.ProcessedMessage, 0, len(decoded))
+	for i := range msgs {
+		order, ok := decoded[i]
+		if !ok {
+			continue
+		}
+		if previous, ok := processed[keys[i]]; ok {
+			// keys recorded before payload hashes were kept cannot be checked
+			if previous.PayloadHash != "" && previous.PayloadHash != hashes[i] {
+				s.logger.Warn("idempotency key reused for a different payload",
+					zap.String("order_uid", order.OrderUID),
+					zap.String("message_key", keys[i]),
+				)
+				results[i] = IngestResult{
+					OrderUID: order.OrderUID,
+					Status:   IngestConflict,
+					Reason:   "idempotency key was already used for a different payload",
+				}
+				continue
+			}
+			s.logger.Info("duplicate message skipped",
+				zap.String("order_uid", order.OrderUID),
+				zap.String("message_key", keys[i]),
+			)
+			results[i] = IngestResult{OrderUID: order.OrderUID, Status: IngestDuplicate}
+			continue
+		}
+		message := repository.ProcessedMessage{Key: keys[i], SchemaVersion: msgs[i].SchemaVersion, PayloadHash: hashes[i]}
+		processed[keys[i]] = message
+		orders = append(orders, order)
+		indexes = append(indexes, i)
+		saved = append(saved, message)
+	}
+
+	if len(orders) == 0 {
+		return withWarnings(results, warnings), nil
+	}
+
+	saveResults, saveErrs, err := s.saveOrders(ctx, orders)
+	stored := make([]repository.ProcessedMessage, 0, len(orders))
+	for j, i := range indexes {
+		if saveErrs[j] != nil {
+			results[i] = failedResult(orders[j].OrderUID, saveErrs[j])
+			continue
+		}
+		stored = append(stored, saved[j])
+
+		result := saveResults[j]
+		s.missing.Remove(result.Order.OrderUID)
+		// a concurrent save of the same order may have cached a newer version
+		s.cache.LoadFromDB([]models.Order{result.Order})
+		results[i] = IngestResult{
+			OrderUID: result.Order.OrderUID,
+			Status:   ingestStatus(result.Status),
+			Version:  result.Order.Version,
+		}
+		s.logger.Info("order processed successfully",
+			zap.String("order_uid", result.Order.OrderUID),
+			zap.String("status", string(result.Status)),
+			zap.Int("version", result.Order.Version),
+		)
+	}
+	s.markProcessed(ctx, stored)
+	return withWarnings(results, warnings), err
+}
+
+// saveOrders saves orders in one transaction and returns a result or an error
+// per order. A permanent error is usually caused by a single order, so the
+// orders are then saved one by one and only the ones to blame fail. The
+// returned error is set if the database failed transiently, in which case
+// every order not saved yet fails with it, or if the only order failed.
+func (s *orderService) saveOrders(ctx context.Context, orders []models.Order) ([]repository.SaveResult, []error, error) {
+	results := make([]repository.SaveResult, len(orders))
+	errs := make([]error, len(orders))
+
+	saved, err := s.repo.SaveOrders(ctx, orders)
+	if err == nil {
+		copy(results, saved)
+		return results, errs, nil
+	}
+
+	s.logger.Error("failed to save orders", zap.Error(err), zap.Int("num_orders", len(orders)))
+	perr := persistError(fmt.Errorf("failed to save orders: %w", err))
+	if perr.Retryable || len(orders) == 1 {
+		for j := range errs {
+			errs[j] = perr
+		}
+		return results, errs, perr
+	}
+
+	s.logger.Warn("saving orders one by one to find the failing ones", zap.Int("num_orders", len(orders)))
+	for j, order := range orders {
+		saved, err := s.repo.SaveOrders(ctx, []models.Order{order})
+		if err == nil {
+			results[j] = saved[0]
+			continue
+		}
+
+		s.logger.Error("failed to save order", zap.Error(err), zap.String("order_uid", order.OrderUID))
+		perr := persistError(fmt.Errorf("failed to save order: %w", err))
+		if perr.Retryable {
+			for k := j; k < len(orders); k++ {
+				errs[k] = perr
+			}
+			return results, errs, perr
+		}
+		errs[j] = perr
+	}
+	return results, errs, nil
+}
+
+func withWarnings(results []IngestResult, warnings []validator.Violations) []IngestResult {
+	for i := range results {
+		results[i].Warnings = warnings[i]
+	}
+	return results
+}
+
+func ingestStatus(status repository.SaveStatus) IngestStatus {
+	switch status {
+	case repository.SaveCreated:
+		return IngestCreated
+	case repository.SaveUpdated:
+		return IngestUpdated
+	case repository.SaveStale:
+		return IngestStale
+	default:
+		return IngestUnchanged
+	}
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/yokitheyo/wb_level0/internal/cache"
+	"github.com/yokitheyo/wb_level0/internal/models"
+)
+
+func orderMessage(uid string) Message {
+	return Message{Data: []byte(`{"order_uid":"` + uid + `"}`)}
+}
+
+func TestIngestOrdersIsolatesPermanentSaveErrors(t *testing.T) {
+	repo := newFakeRepository()
+	repo.saveErr = func(orders []models.Order) error {
+		for _, order := range orders {
+			if order.OrderUID == "bad" {
+				return &pgconn.PgError{Code: "22001", Message: "value too long for type character varying(10)"}
+			}
+		}
+		return nil
+	}
+	service := newTestService(repo)
+
+	results, err := service.IngestOrders(context.Background(), []Message{
+		orderMessage("first"),
+		orderMessage("bad"),
+		orderMessage("last"),
+	})
+	if err != nil {
+		t.Fatalf("expected no batch error, got %v", err)
+	}
+
+	want := []IngestStatus{IngestCreated, IngestFailed, IngestCreated}
+	for i, result := range results {
+		if result.Status != want[i] {
+			t.Errorf("order %d (%s): status %s, want %s", i, result.OrderUID, result.Status, want[i])
+		}
+	}
+	if results[1].err == nil || IsRetryable(results[1].err) {
+		t.Errorf("expected a permanent error for the bad order, got %v", results[1].err)
+	}
+
+	// the failed order is not marked as processed, so it can be sent again
+	processed, _ := repo.ProcessedMessages(context.Background(), []string{messageKey(orderMessage("bad").Data)})
+	if len(processed) != 0 {
+		t.Error("expected the failed order not to be marked as processed")
+	}
+}
+
+func TestIngestOrdersFailsWholeBatchOnTransientErrors(t *testing.T) {
+	repo := newFakeRepository()
+	repo.saveErr = func([]models.Order) error {
+		return &pgconn.PgError{Code: "57P03", Message: "the database system is starting up"}
+	}
+	service := newTestService(repo)
+
+	results, err := service.IngestOrders(context.Background(), []Message{orderMessage("a"), orderMessage("b")})
+	if err == nil || !IsRetryable(err) {
+		t.Fatalf("expected a retryable error, got %v", err)
+	}
+	for _, result := range results {
+		if result.Status != IngestFailed {
+			t.Errorf("order %s: status %s, want %s", result.OrderUID, result.Status, IngestFailed)
+		}
+	}
+	if got := repo.saved(); got != 1 {
+		t.Errorf("expected a transient failure not to be retried order by order, got %d saves", got)
+	}
+}
+
+func TestIngestOrderSkipsProcessedMessages(t *testing.T) {
+	repo := newFakeRepository()
+	service := newTestService(repo)
+	msg := orderMessage("replayed")
+
+	for i, want := range []IngestStatus{IngestCreated, IngestDuplicate, IngestDuplicate} {
+		result, err := service.IngestOrder(context.Background(), msg)
+		if err != nil {
+			t.Fatalf("delivery %d: unexpected error %v", i, err)
+		}
+		if result.Status != want {
+			t.Fatalf("delivery %d: status %s, want %s", i, result.Status, want)
+		}
+	}
+	if got := repo.saved(); got != 1 {
+		t.Fatalf("expected redeliveries not to reach the repository, got %d saves", got)
+	}
+}
+
+func TestIngestOrderUsesIdempotencyKey(t *testing.T) {
+	repo := newFakeRepository()
+	service := newTestService(repo)
+	msg := orderMessage("keyed")
+	msg.IdempotencyKey = "submission-1"
+
+	if result, _ := service.IngestOrder(context.Background(), msg); result.Status != IngestCreated {
+		t.Fatalf("first submission: status %s, want %s", result.Status, IngestCreated)
+	}
+	if result, _ := service.IngestOrder(context.Background(), msg); result.Status != IngestDuplicate {
+		t.Fatalf("retried submission: status %s, want %s", result.Status, IngestDuplicate)
+	}
+
+	// the key, not the content, identifies the submission
+	msg.IdempotencyKey = "submission-2"
+	if result, _ := service.IngestOrder(context.Background(), msg); result.Status != IngestUpdated {
+		t.Fatalf("new submission: status %s, want %s", result.Status, IngestUpdated)
+	}
+	if got := repo.saved(); got != 2 {
+		t.Fatalf("expected 2 saves, got %d", got)
+	}
+}
+
+func TestIngestOrderRejectsIdempotencyKeyReuse(t *testing.T) {
+	repo := newFakeRepository()
+	service := newTestService(repo)
+	first := orderMessage("first")
+	first.IdempotencyKey = "submission"
+	other := orderMessage("other")
+	other.IdempotencyKey = "submission"
+
+	if result, _ := service.IngestOrder(context.Background(), first); result.Status != IngestCreated {
+		t.Fatalf("first submission: status %s, want %s", result.Status, IngestCreated)
+	}
+	result, err := service.IngestOrder(context.Background(), other)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if result.Status != IngestConflict {
+		t.Fatalf("reused key: status %s, want %s", result.Status, IngestConflict)
+	}
+	if got := repo.saved(); got != 1 {
+		t.Fatalf("expected the conflicting order not to be saved, got %d saves", got)
+	}
+
+	// within one batch the second use of a key conflicts as well
+	third := orderMessage("third")
+	third.IdempotencyKey = "batch"
+	fourth := orderMessage("fourth")
+	fourth.IdempotencyKey = "batch"
+	results, _ := service.IngestOrders(context.Background(), []Message{third, fourth})
+	if results[0].Status != IngestCreated || results[1].Status != IngestConflict {
+		t.Fatalf("batch: statuses %s, %s, want %s, %s", results[0].Status, results[1].Status, IngestCreated, IngestConflict)
+	}
+}
+
+func TestIngestOrderForgetsMissingOrder(t *testing.T) {
+	service := newTestService(newFakeRepository())
+	service.missing = cache.NewNegativeCache(time.Minute)
+	service.missing.Add("late")
+
+	stats := service.GetCacheStats()
+	if stats.NegativeEntries != 1 || stats.NegativeTTL != "1m0s" {
+		t.Fatalf("expected 1 negative entry with ttl 1m0s, got %d and %s", stats.NegativeEntries, stats.NegativeTTL)
+	}
+
+	if result, _ := service.IngestOrder(context.Background(), orderMessage("late")); result.Status != IngestCreated {
+		t.Fatalf("status %s, want %s", result.Status, IngestCreated)
+	}
+	if service.missing.Contains("late") {
+		t.Fatal("expected the ingested order to be removed from the negative cache")
+	}
+	order, err := service.GetOrderByID(context.Background(), "late")
+	if err != nil || order == nil {
+		t.Fatalf("expected the ingested order to be found, got %v, %v", order, err)
+	}
+}
@@ -2,210 +2,428 @@ package services
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"strings"
+	"sort"
+	"sync/atomic"
+	"time"
 
 	"github.com/yokitheyo/wb_level0/internal/cache"
+	"github.com/yokitheyo/wb_level0/internal/export"
 	"github.com/yokitheyo/wb_level0/internal/models"
 	"github.com/yokitheyo/wb_level0/internal/repository"
+	"github.com/yokitheyo/wb_level0/internal/validator"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 )
 
 type OrderService interface {
-	ProcessOrder(ctx context.Context, data []byte) error
+	ProcessOrder(ctx context.Context, msg Message) error
+	ProcessOrders(ctx context.Context, msgs []Message) []error
+	IngestOrder(ctx context.Context, msg Message) (IngestResult, error)
+	IngestOrders(ctx context.Context, msgs []Message) ([]IngestResult, error)
 	GetOrderByID(ctx context.Context, orderUID string) (*models.Order, error)
+	GetOrderHistory(ctx context.Context, orderUID string) ([]models.OrderRevision, error)
+	SearchOrders(ctx context.Context, q repository.OrderQuery) (repository.OrderPage, error)
+	ExportOrders(ctx context.Context, filter repository.OrderFilter, w export.Writer) (int, error)
+	GetOrdersByTrackNumber(ctx context.Context, trackNumber string, limit int) ([]models.Order, bool, error)
+	GetOrdersByCustomer(ctx context.Context, customerID string, limit int) ([]models.Order, bool, error)
 	RestoreCache(ctx context.Context) error
+	RestoreCacheSince(ctx context.Context, since time.Time) error
+	GetWarmupStatus() WarmupStatus
 	GetCacheStats() cache.CacheStats
+	ListCachedUIDs(after, prefix string, limit int) []string
+	EvictOrder(orderUID string) bool
+	EvictOrdersByPrefix(prefix string) int
+	FlushCache() int
+	ReloadOrder(ctx context.Context, orderUID string) (*models.Order, error)
+	VerifyCache(ctx context.Context, opts VerifyOptions) (VerificationReport, error)
+	LastVerification() *VerificationReport
+	CleanupProcessedMessages(ctx context.Context, retention time.Duration) (int64, error)
 }
 
+const warmupBatchSize = 1000
+
 type orderService struct {
-	repo   repository.OrderRepository
-	cache  cache.OrderCache
-	logger *zap.Logger
+	repo      repository.OrderRepository
+	cache     cache.OrderCache
+	missing   *cache.NegativeCache
+	decoder   *validator.Decoder
+	validator *validator.Validator
+	warmup    *warmupTracker
+	restoring atomic.Bool
+	// complete is set while the cache holds every stored order, which is
+	// the case after a full restore into a cache that does not evict
+	complete     atomic.Bool
+	verification verificationStore
+	lookups      singleflight.Group
+	logger       *zap.Logger
 }
 
 func NewOrderService(repo repository.OrderRepository,
 	cache cache.OrderCache,
+	missing *cache.NegativeCache,
+	decoder *validator.Decoder,
+	validator *validator.Validator,
 	logger *zap.Logger) OrderService {
 	return &orderService{
-		repo:   repo,
-		cache:  cache,
-		logger: logger,
+		repo:      repo,
+		cache:     cache,
+		missing:   missing,
+		decoder:   decoder,
+		validator: validator,
+		warmup:    newWarmupTracker(),
+		logger:    logger,
 	}
 }
 
-func (s *orderService) ProcessOrder(ctx context.Context, data []byte) error {
-	var order models.Order
-	if err := json.Unmarshal(data, &order); err != nil {
-		s.logger.Error("failed to unmarshal order", zap.Error(err), zap.String("data", string(data)))
-		return fmt.Errorf("failed to unmarshal order: %w", err)
-	}
-
-	if err := s.validateOrder(order); err != nil {
-		s.logger.Error("invalid order data", zap.Error(err), zap.String("order_uid", order.OrderUID))
-		return fmt.Errorf("invalid order data: %w", err)
-	}
-
-	if err := s.repo.SaveOrder(ctx, order); err != nil {
-		s.logger.Error("failed to save order", zap.Error(err), zap.String("order_uid", order.OrderUID))
-		return fmt.Errorf("failed to save order: %w", err)
+func (s *orderService) ProcessOrder(ctx context.Context, msg Message) error {
+	result, err := s.IngestOrder(ctx, msg)
+	if err != nil {
+		return err
 	}
-
-	s.cache.Set(order.OrderUID, order)
-	s.logger.Info("order processed successfully", zap.String("order_uid", order.OrderUID))
-	return nil
+	return result.err
 }
 
-func (s *orderService) GetOrderByID(ctx context.Context, orderUID string) (*models.Order, error) {
-	if order, ok := s.cache.Get(orderUID); ok {
-		s.logger.Debug("order found in cache", zap.String("order_uid", orderUID))
-		return &order, nil
+// ProcessOrders decodes and validates every message and saves the valid
+// orders in one transaction. The returned slice holds one error per message,
+// nil for the ones that were saved.
+func (s *orderService) ProcessOrders(ctx context.Context, msgs []Message) []error {
+	results, _ := s.IngestOrders(ctx, msgs)
+	errs := make([]error, len(results))
+	for i, result := range results {
+		errs[i] = result.err
 	}
+	return errs
+}
 
-	s.logger.Debug("order not found in cache, trying database", zap.String("order_uid", orderUID))
-	order, err := s.repo.GetOrderByID(ctx, orderUID)
-	if err != nil {
-		s.logger.Error("failed to get order from database", zap.Error(err), zap.String("order_uid", orderUID))
-		return nil, fmt.Errorf("failed to get order: %w", err)
+// markProcessed records message keys after their orders are saved. Failing
+// to do so is not fatal: saving is idempotent, so a redelivered message is
+// simply written again.
+func (s *orderService) markProcessed(ctx context.Context, messages []repository.ProcessedMessage) {
+	if len(messages) == 0 {
+		return
 	}
-
-	if order != nil {
-		s.cache.Set(orderUID, *order)
+	if err := s.repo.MarkProcessed(ctx, messages); err != nil {
+		s.logger.Warn("failed to mark messages as processed", zap.Error(err), zap.Int("num_messages", len(messages)))
 	}
-	return order, nil
 }
 
-func (s *orderService) RestoreCache(ctx context.Context) error {
-	s.logger.Info("restoring cache from database")
-	orders, err := s.repo.GetAllOrders(ctx)
+// CleanupProcessedMessages forgets the message keys recorded more than
+// retention ago. A message redelivered after that is saved again, which is
+// harmless because saving is idempotent.
+func (s *orderService) CleanupProcessedMessages(ctx context.Context, retention time.Duration) (int64, error) {
+	deleted, err := s.repo.DeleteProcessedMessages(ctx, retention)
 	if err != nil {
-		s.logger.Error("failed to get orders from database", zap.Error(err))
-		return fmt.Errorf("failed to get orders: %w", err)
+		s.logger.Error("failed to clean up processed messages", zap.Error(err))
+		return 0, err
 	}
-	s.cache.LoadFromDB(orders)
-	s.logger.Info("orders restored successfully", zap.Int("num_orders", len(orders)))
-	return nil
+	if deleted > 0 {
+		s.logger.Info("processed messages cleaned up",
+			zap.Int64("deleted", deleted),
+			zap.Duration("retention", retention),
+		)
+	}
+	return deleted, nil
 }
 
-func (s *orderService) GetCacheStats() cache.CacheStats {
-	return s.cache.GetStats()
+func messageKey(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
 }
 
-func (s *orderService) validateOrder(order models.Order) error {
-	if order.OrderUID == "" {
-		return fmt.Errorf("missing order_uid")
+// decodeOrder also returns the violations that are only reported: unknown
+// fields in warn mode and the rules configured to warn.
+func (s *orderService) decodeOrder(msg Message) (models.Order, validator.Violations, error) {
+	order, warnings, err := s.decoder.Decode(msg.Data)
+	if err != nil {
+		s.logger.Error("failed to unmarshal order",
+			zap.Error(err),
+			zap.String("schema_version", msg.SchemaVersion),
+			zap.String("data", string(msg.Data)),
+		)
+		return order, warnings, &ProcessError{Stage: StageUnmarshal, Err: fmt.Errorf("failed to unmarshal order: %w", err)}
 	}
 
-	if order.TrackNumber == "" {
-		return fmt.Errorf("missing track_number")
+	validationWarnings, err := s.validator.Validate(order)
+	warnings = append(warnings, validationWarnings...)
+	if err != nil {
+		s.logger.Error("invalid order data", zap.Error(err), zap.String("order_uid", order.OrderUID))
+		return order, warnings, &ProcessError{Stage: StageValidate, Err: fmt.Errorf("invalid order data: %w", err)}
+	}
+	if len(warnings) > 0 {
+		s.logger.Warn("order accepted with warnings",
+			zap.String("warnings", warnings.Error()),
+			zap.String("order_uid", order.OrderUID),
+			zap.String("schema_version", msg.SchemaVersion),
+		)
 	}
 
-	if order.Entry == "" {
-		return fmt.Errorf("missing entry")
+	return order, warnings, nil
+}
+
+func (s *orderService) GetOrderByID(ctx context.Context, orderUID string) (*models.Order, error) {
+	if order, ok := s.cache.Get(orderUID); ok {
+		s.logger.Debug("order found in cache", zap.String("order_uid", orderUID))
+		return &order, nil
 	}
 
-	if order.CustomerID == "" {
-		return fmt.Errorf("missing customer_id")
+	if s.missing.Contains(orderUID) {
+		s.logger.Debug("order is known to be missing", zap.String("order_uid", orderUID))
+		return nil, nil
 	}
 
-	if order.DeliveryService == "" {
-		return fmt.Errorf("missing delivery_service")
+	s.logger.Debug("order not found in cache, trying database", zap.String("order_uid", orderUID))
+
+	// concurrent misses for the same order share one database lookup. It is
+	// detached from the callers' cancellation, so a caller that gives up
+	// does not fail the lookup for the others
+	fetchCtx := context.WithoutCancel(ctx)
+	lookup := s.lookups.DoChan(orderUID, func() (interface{}, error) {
+		order, err := s.repo.GetOrderByID(fetchCtx, orderUID)
+		if err != nil {
+			return nil, err
+		}
+		if order == nil {
+			s.missing.Add(orderUID)
+			return nil, nil
+		}
+		// ingestion may have cached a newer version while the order was read
+		s.cache.LoadFromDB([]models.Order{*order})
+		return order, nil
+	})
+
+	var res singleflight.Result
+	select {
+	case res = <-lookup:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if res.Err != nil {
+		s.logger.Error("failed to get order from database", zap.Error(res.Err), zap.String("order_uid", orderUID))
+		return nil, fmt.Errorf("failed to get order: %w", res.Err)
+	}
+	if res.Shared {
+		s.logger.Debug("database lookup shared with concurrent requests", zap.String("order_uid", orderUID))
 	}
 
-	if err := s.validateDelivery(order.Delivery); err != nil {
-		return fmt.Errorf("invalid delivery: %w", err)
+	order, _ := res.Val.(*models.Order)
+	if order == nil {
+		return nil, nil
 	}
+	result := *order
+	return &result, nil
+}
 
-	if err := s.validatePayment(order.Payment); err != nil {
-		return fmt.Errorf("invalid payment: %w", err)
+func (s *orderService) GetOrderHistory(ctx context.Context, orderUID string) ([]models.OrderRevision, error) {
+	revisions, err := s.repo.GetOrderHistory(ctx, orderUID)
+	if err != nil {
+		s.logger.Error("failed to get order history", zap.Error(err), zap.String("order_uid", orderUID))
+		return nil, fmt.Errorf("failed to get order history: %w", err)
 	}
+	return revisions, nil
+}
 
-	if len(order.Items) == 0 {
-		return fmt.Errorf("no items in order")
+// SearchOrders always reads from the database: the cache may hold only part
+// of the orders, so it cannot answer queries on its own.
+func (s *orderService) SearchOrders(ctx context.Context, q repository.OrderQuery) (repository.OrderPage, error) {
+	page, err := s.repo.SearchOrders(ctx, q)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidCursor) {
+			return page, err
+		}
+		s.logger.Error("failed to search orders", zap.Error(err))
+		return page, fmt.Errorf("failed to search orders: %w", err)
 	}
+	return page, nil
+}
 
-	for i, item := range order.Items {
-		if err := s.validateItem(item); err != nil {
-			return fmt.Errorf("invalid item at index %d: %w", i, err)
+// ExportOrders streams the orders matching filter from the database into w
+// and returns how many were written. w is not closed.
+func (s *orderService) ExportOrders(ctx context.Context, filter repository.OrderFilter, w export.Writer) (int, error) {
+	written := 0
+	err := s.repo.StreamOrders(ctx, filter, func(order models.Order) error {
+		if err := w.Write(order); err != nil {
+			return err
 		}
+		written++
+		return nil
+	})
+	if err != nil {
+		s.logger.Error("failed to export orders", zap.Error(err), zap.Int("num_orders", written))
+		return written, fmt.Errorf("failed to export orders: %w", err)
 	}
+	return written, nil
+}
 
-	return nil
+func (s *orderService) GetOrdersByTrackNumber(ctx context.Context, trackNumber string, limit int) ([]models.Order, bool, error) {
+	return s.findOrders(ctx, repository.OrderFilter{TrackNumber: trackNumber}, limit, func() []models.Order {
+		return s.cache.FindByTrackNumber(trackNumber)
+	})
 }
 
-func (s *orderService) validateDelivery(delivery models.Delivery) error {
-	if delivery.Name == "" {
-		return fmt.Errorf("missing delivery name")
-	}
+func (s *orderService) GetOrdersByCustomer(ctx context.Context, customerID string, limit int) ([]models.Order, bool, error) {
+	return s.findOrders(ctx, repository.OrderFilter{CustomerID: customerID}, limit, func() []models.Order {
+		return s.cache.FindByCustomer(customerID)
+	})
+}
 
-	if delivery.Phone == "" {
-		return fmt.Errorf("missing delivery phone")
+// findOrders returns up to limit orders matching filter, newest first, and
+// whether there are more. The cache indexes answer the lookup only while the
+// cache holds every order: during warm-up, after eviction or expiry, or when
+// only some of the matching orders were read, they may be missing orders.
+// Otherwise the database is queried and the found orders are cached.
+func (s *orderService) findOrders(ctx context.Context,
+	filter repository.OrderFilter,
+	limit int,
+	fromCache func() []models.Order) ([]models.Order, bool, error) {
+	if s.complete.Load() {
+		orders := fromCache()
+		sort.Slice(orders, func(i, j int) bool {
+			if !orders[i].DateCreated.Equal(orders[j].DateCreated) {
+				return orders[i].DateCreated.After(orders[j].DateCreated)
+			}
+			return orders[i].OrderUID > orders[j].OrderUID
+		})
+		if len(orders) > limit {
+			return orders[:limit], true, nil
+		}
+		return orders, false, nil
 	}
 
-	if delivery.City == "" {
-		return fmt.Errorf("missing delivery city")
+	page, err := s.repo.SearchOrders(ctx, repository.OrderQuery{
+		Filter: filter,
+		Sort:   repository.SortNewestFirst,
+		Limit:  limit,
+	})
+	if err != nil {
+		s.logger.Error("failed to find orders", zap.Error(err))
+		return nil, false, fmt.Errorf("failed to find orders: %w", err)
 	}
-
-	if delivery.Address == "" {
-		return fmt.Errorf("missing delivery address")
+	if len(page.Orders) > 0 {
+		s.cache.LoadFromDB(page.Orders)
 	}
+	return page.Orders, page.NextCursor != "", nil
+}
 
-	if delivery.Email != "" && !strings.Contains(delivery.Email, "@") {
-		return fmt.Errorf("invalid email format")
+// RestoreCache loads all orders into the cache one page at a time. Progress
+// is reported by GetWarmupStatus, so it can run in the background while
+// requests are served and cache misses fall back to the database.
+func (s *orderService) RestoreCache(ctx context.Context) error {
+	s.logger.Info("restoring cache from database")
+	if err := s.restoreCache(ctx, repository.OrderFilter{}); err != nil {
+		return err
 	}
-
+	s.complete.Store(!s.cache.Bounded())
 	return nil
 }
 
-func (s *orderService) validatePayment(payment models.Payment) error {
-	if payment.Transaction == "" {
-		return fmt.Errorf("missing payment transaction")
-	}
+// RestoreCacheSince tops up a cache loaded from a snapshot with the orders
+// saved or updated since the snapshot was taken.
+func (s *orderService) RestoreCacheSince(ctx context.Context, since time.Time) error {
+	s.logger.Info("restoring cache from database", zap.Time("updated_since", since))
+	return s.restoreCache(ctx, repository.OrderFilter{UpdatedSince: since})
+}
 
-	if payment.Currency == "" {
-		return fmt.Errorf("missing payment currency")
+func (s *orderService) restoreCache(ctx context.Context, filter repository.OrderFilter) error {
+	if !s.restoring.CompareAndSwap(false, true) {
+		return ErrRestoreInProgress
 	}
+	defer s.restoring.Store(false)
 
-	if payment.Provider == "" {
-		return fmt.Errorf("missing payment provider")
+	total, err := s.repo.CountOrders(ctx, filter)
+	if err != nil {
+		s.logger.Error("failed to count orders in database", zap.Error(err))
+		s.warmup.finish(err)
+		return fmt.Errorf("failed to count orders: %w", err)
 	}
+	s.warmup.start(total)
 
-	if payment.Amount <= 0 {
-		return fmt.Errorf("invalid payment amount: %d", payment.Amount)
+	it := s.repo.IterateOrders(filter, warmupBatchSize)
+	for it.Next(ctx) {
+		orders := it.Orders()
+		s.cache.LoadFromDB(orders)
+		s.warmup.progress(len(orders))
 	}
-
-	if payment.Bank == "" {
-		return fmt.Errorf("missing payment bank")
+	if err := it.Err(); err != nil {
+		s.logger.Error("failed to get orders from database", zap.Error(err))
+		s.warmup.finish(err)
+		return fmt.Errorf("failed to get orders: %w", err)
 	}
 
+	s.warmup.finish(nil)
+	s.logger.Info("orders restored successfully", zap.Int("num_orders", s.warmup.get().Loaded))
 	return nil
 }
 
-func (s *orderService) validateItem(item models.Item) error {
-	if item.ChrtID <= 0 {
-		return fmt.Errorf("invalid chrt_id: %d", item.ChrtID)
-	}
+func (s *orderService) GetWarmupStatus() WarmupStatus {
+	return s.warmup.get()
+}
 
-	if item.TrackNumber == "" {
-		return fmt.Errorf("missing item track_number")
-	}
+func (s *orderService) GetCacheStats() cache.CacheStats {
+	stats := s.cache.GetStats()
+	stats.NegativeTTL = s.missing.TTL().String()
+	stats.NegativeEntries = s.missing.Len()
+
+	warmup := s.warmup.get()
+	switch warmup.State {
+	case WarmupRunning:
+		stats.LoadDuration = time.Since(warmup.StartedAt).String()
+	case WarmupDone, WarmupFailed:
+		stats.LoadDuration = warmup.FinishedAt.Sub(warmup.StartedAt).String()
+	}
+	return stats
+}
 
-	if item.Name == "" {
-		return fmt.Errorf("missing item name")
-	}
+func (s *orderService) ListCachedUIDs(after, prefix string, limit int) []string {
+	return s.cache.ListUIDs(after, prefix, limit)
+}
 
-	if item.Price <= 0 {
-		return fmt.Errorf("invalid item price: %d", item.Price)
-	}
+// EvictOrder drops one order from the cache, including a cached "not found"
+// result, so that the next lookup reads it from the database.
+func (s *orderService) EvictOrder(orderUID string) bool {
+	s.complete.Store(false)
+	s.missing.Remove(orderUID)
+	evicted := s.cache.Delete(orderUID)
+	s.logger.Info("order evicted from cache", zap.String("order_uid", orderUID), zap.Bool("was_cached", evicted))
+	return evicted
+}
+
+func (s *orderService) EvictOrdersByPrefix(prefix string) int {
+	s.complete.Store(false)
+	evicted := s.cache.DeleteByPrefix(prefix)
+	s.logger.Info("orders evicted from cache", zap.String("prefix", prefix), zap.Int("num_orders", evicted))
+	return evicted
+}
+
+func (s *orderService) FlushCache() int {
+	s.complete.Store(false)
+	s.missing.Clear()
+	flushed := s.cache.Flush()
+	s.logger.Info("cache flushed", zap.Int("num_orders", flushed))
+	return flushed
+}
 
-	if item.TotalPrice <= 0 {
-		return fmt.Errorf("invalid item total_price: %d", item.TotalPrice)
+// ReloadOrder replaces the cached copy of an order with the one stored in
+// the database. It returns nil if the order does not exist.
+func (s *orderService) ReloadOrder(ctx context.Context, orderUID string) (*models.Order, error) {
+	order, err := s.repo.GetOrderByID(ctx, orderUID)
+	if err != nil {
+		s.logger.Error("failed to reload order", zap.Error(err), zap.String("order_uid", orderUID))
+		return nil, fmt.Errorf("failed to reload order: %w", err)
 	}
 
-	if item.Brand == "" {
-		return fmt.Errorf("missing item brand")
+	if order == nil {
+		s.cache.Delete(orderUID)
+		s.missing.Add(orderUID)
+		s.logger.Info("reloaded order no longer exists", zap.String("order_uid", orderUID))
+		return nil, nil
 	}
 
-	return nil
+	s.missing.Remove(orderUID)
+	s.cache.LoadFromDB([]models.Order{*order})
+	s.logger.Info("order reloaded into cache", zap.String("order_uid", orderUID), zap.Int("version", order.Version))
+	return order, nil
 }
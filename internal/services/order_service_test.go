@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yokitheyo/wb_level0/internal/models"
+	"github.com/yokitheyo/wb_level0/internal/repository"
+)
+
+// lookupRepository counts lookups and holds each one until release is
+// closed, so that concurrent requests overlap.
+type lookupRepository struct {
+	repository.OrderRepository
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (r *lookupRepository) GetOrderByID(_ context.Context, orderUID string) (*models.Order, error) {
+	r.calls.Add(1)
+	<-r.release
+	return &models.Order{OrderUID: orderUID, Version: 1}, nil
+}
+
+func TestGetOrderByIDCoalescesConcurrentMisses(t *testing.T) {
+	const requests = 100
+	repo := &lookupRepository{release: make(chan struct{})}
+	service := newTestService(repo)
+
+	var started, done sync.WaitGroup
+	var failed atomic.Int32
+	for i := 0; i < requests; i++ {
+		started.Add(1)
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			started.Done()
+			order, err := service.GetOrderByID(context.Background(), "b563feb7b2b84b6test")
+			if err != nil || order == nil || order.OrderUID != "b563feb7b2b84b6test" {
+				failed.Add(1)
+			}
+		}()
+	}
+	started.Wait()
+	time.Sleep(10 * time.Millisecond)
+	close(repo.release)
+	done.Wait()
+
+	if got := repo.calls.Load(); got != 1 {
+		t.Fatalf("expected 1 repository lookup, got %d", got)
+	}
+	if got := failed.Load(); got != 0 {
+		t.Fatalf("%d requests did not get the order", got)
+	}
+}
+
+func TestGetOrderByIDReturnsWhenCallerGivesUp(t *testing.T) {
+	repo := &lookupRepository{release: make(chan struct{})}
+	service := newTestService(repo)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := service.GetOrderByID(ctx, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the caller's deadline error, got %v", err)
+	}
+
+	// the shared lookup carries on and fills the cache for later callers
+	close(repo.release)
+	deadline := time.Now().Add(5 * time.Second)
+	for _, ok := service.cache.Get("slow"); !ok; _, ok = service.cache.Get("slow") {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the shared lookup to fill the cache")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	order, err := service.GetOrderByID(context.Background(), "slow")
+	if err != nil || order == nil {
+		t.Fatalf("expected the order, got %v, %v", order, err)
+	}
+	if got := repo.calls.Load(); got != 1 {
+		t.Fatalf("expected 1 repository lookup, got %d", got)
+	}
+}
+
+func TestGetOrderByIDKeepsNewerCachedVersion(t *testing.T) {
+	repo := &lookupRepository{release: make(chan struct{})}
+	service := newTestService(repo)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		service.GetOrderByID(context.Background(), "updated")
+	}()
+	for repo.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// ingestion caches version 2 while the lookup still reads version 1
+	service.cache.Set("updated", models.Order{OrderUID: "updated", Version: 2})
+	close(repo.release)
+	<-done
+
+	if order, _ := service.cache.Peek("updated"); order.Version != 2 {
+		t.Fatalf("expected the newer cached version to be kept, got version %d", order.Version)
+	}
+
+	if _, err := service.ReloadOrder(context.Background(), "updated"); err != nil {
+		t.Fatal(err)
+	}
+	if order, _ := service.cache.Peek("updated"); order.Version != 2 {
+		t.Fatalf("expected reloading an older version to keep the cached one, got version %d", order.Version)
+	}
+}
+
+// searchRepository counts searches and returns the orders it holds.
+type searchRepository struct {
+	repository.OrderRepository
+	searches atomic.Int32
+	orders   []models.Order
+}
+
+func (r *searchRepository) SearchOrders(_ context.Context, q repository.OrderQuery) (repository.OrderPage, error) {
+	r.searches.Add(1)
+	var page repository.OrderPage
+	for _, order := range r.orders {
+		if order.CustomerID == q.Filter.CustomerID {
+			page.Orders = append(page.Orders, order)
+		}
+	}
+	return page, nil
+}
+
+func TestGetOrdersByCustomerUsesCacheOnlyWhenComplete(t *testing.T) {
+	alice := []models.Order{
+		{OrderUID: "a", CustomerID: "alice", DateCreated: time.Date(2021, 11, 26, 0, 0, 0, 0, time.UTC)},
+		{OrderUID: "b", CustomerID: "alice", DateCreated: time.Date(2021, 11, 27, 0, 0, 0, 0, time.UTC)},
+	}
+	repo := &searchRepository{orders: alice}
+	service := newTestService(repo)
+
+	// a single order lookup cached one of alice's orders; the cache is
+	// partial, so the lookup must still ask the database
+	service.cache.Set("a", alice[0])
+	orders, more, err := service.GetOrdersByCustomer(context.Background(), "alice", 10)
+	if err != nil || len(orders) != 2 || more {
+		t.Fatalf("expected both orders from the database, got %v, %v, %v", orders, more, err)
+	}
+	if got := repo.searches.Load(); got != 1 {
+		t.Fatalf("expected a partial cache to fall back to the database, got %d searches", got)
+	}
+
+	// once the cache holds every order, the indexes answer on their own
+	service.cache.LoadFromDB(alice)
+	service.complete.Store(true)
+	orders, _, err = service.GetOrdersByCustomer(context.Background(), "alice", 10)
+	if err != nil || len(orders) != 2 {
+		t.Fatalf("expected 2 orders, got %v, %v", orders, err)
+	}
+	if orders[0].OrderUID != "b" {
+		t.Errorf("expected the newest order first, got %s", orders[0].OrderUID)
+	}
+	if _, _, err := service.GetOrdersByCustomer(context.Background(), "bob", 10); err != nil {
+		t.Fatal(err)
+	}
+	if got := repo.searches.Load(); got != 1 {
+		t.Fatalf("expected a complete cache to answer without the database, got %d searches", got)
+	}
+}
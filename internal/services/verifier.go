@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/yokitheyo/wb_level0/internal/models"
+	"github.com/yokitheyo/wb_level0/internal/repository"
+	"go.uber.org/zap"
+)
+
+const (
+	verifyBatchSize = 500
+	// maxReportedDrift caps the number of drifted orders listed in a report;
+	// the counters still cover all of them.
+	maxReportedDrift = 100
+)
+
+type DriftKind string
+
+const (
+	// DriftStale is a cached order whose version differs from the stored one.
+	DriftStale DriftKind = "stale"
+	// DriftOrphaned is a cached order that is not in the database.
+	DriftOrphaned DriftKind = "orphaned"
+	// DriftMissing is a stored order that is not cached. It is only checked
+	// for when the cache is expected to hold every order.
+	DriftMissing DriftKind = "missing"
+)
+
+type Drift struct {
+	OrderUID      string    `json:"order_uid"`
+	Kind          DriftKind `json:"kind"`
+	CachedVersion int       `json:"cached_version,omitempty"`
+	StoredVersion int       `json:"stored_version,omitempty"`
+}
+
+type VerifyOptions struct {
+	// Repair brings drifted cache entries in line with the database.
+	Repair bool
+	// CheckMissing also scans the database for orders absent from the cache.
+	CheckMissing bool
+}
+
+type VerificationReport struct {
+	StartedAt     time.Time `json:"started_at"`
+	FinishedAt    time.Time `json:"finished_at"`
+	Repair        bool      `json:"repair"`
+	CheckedCached int       `json:"checked_cached"`
+	CheckedStored int       `json:"checked_stored"`
+	Stale         int       `json:"stale"`
+	Orphaned      int       `json:"orphaned"`
+	Missing       int       `json:"missing"`
+	Repaired      int       `json:"repaired"`
+	Drift         []Drift   `json:"drift"`
+	Error         string    `json:"error,omitempty"`
+}
+
+func (r *VerificationReport) Drifted() int {
+	return r.Stale + r.Orphaned + r.Missing
+}
+
+func (r *VerificationReport) record(d Drift) {
+	switch d.Kind {
+	case DriftStale:
+		r.Stale++
+	case DriftOrphaned:
+		r.Orphaned++
+	case DriftMissing:
+		r.Missing++
+	}
+	if len(r.Drift) < maxReportedDrift {
+		r.Drift = append(r.Drift, d)
+	}
+}
+
+type verificationStore struct {
+	mu      sync.Mutex
+	running bool
+	last    *VerificationReport
+}
+
+// VerifyCache compares the cached orders with the database. Orders are
+// compared by version and updated_at, which change on every write.
+func (s *orderService) VerifyCache(ctx context.Context, opts VerifyOptions) (VerificationReport, error) {
+	s.verification.mu.Lock()
+	if s.verification.running {
+		s.verification.mu.Unlock()
+		return VerificationReport{}, ErrVerificationInProgress
+	}
+	s.verification.running = true
+	s.verification.mu.Unlock()
+
+	report := VerificationReport{
+		StartedAt: time.Now(),
+		Repair:    opts.Repair,
+		Drift:     []Drift{},
+	}
+	err := s.verifyCached(ctx, opts, &report)
+	if err == nil && opts.CheckMissing {
+		err = s.verifyStored(ctx, opts, &report)
+	}
+	report.FinishedAt = time.Now()
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	s.verification.mu.Lock()
+	s.verification.running = false
+	s.verification.last = &report
+	s.verification.mu.Unlock()
+
+	if err != nil {
+		s.logger.Error("cache verification failed", zap.Error(err))
+		return report, fmt.Errorf("failed to verify cache: %w", err)
+	}
+
+	log := s.logger.Info
+	if report.Drifted() > 0 {
+		log = s.logger.Warn
+	}
+	log("cache verification finished",
+		zap.Int("checked_cached", report.CheckedCached),
+		zap.Int("checked_stored", report.CheckedStored),
+		zap.Int("stale", report.Stale),
+		zap.Int("orphaned", report.Orphaned),
+		zap.Int("missing", report.Missing),
+		zap.Int("repaired", report.Repaired),
+	)
+	return report, nil
+}
+
+// LastVerification returns the report of the latest VerifyCache run, or nil
+// if none has run yet.
+func (s *orderService) LastVerification() *VerificationReport {
+	s.verification.mu.Lock()
+	defer s.verification.mu.Unlock()
+	return s.verification.last
+}
+
+// verifyCached walks the cache page by page and looks every page up in the
+// database.
+func (s *orderService) verifyCached(ctx context.Context, opts VerifyOptions, report *VerificationReport) error {
+	after := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		uids := s.cache.ListUIDs(after, "", verifyBatchSize)
+		if len(uids) == 0 {
+			return nil
+		}
+		after = uids[len(uids)-1]
+
+		cached := make(map[string]models.Order, len(uids))
+		for _, uid := range uids {
+			if order, ok := s.cache.Peek(uid); ok {
+				cached[uid] = order
+			}
+		}
+
+		stored, err := s.repo.GetOrdersByIDs(ctx, uids)
+		if err != nil {
+			return fmt.Errorf("failed to get orders: %w", err)
+		}
+		storedByUID := make(map[string]models.Order, len(stored))
+		for _, order := range stored {
+			storedByUID[order.OrderUID] = order
+		}
+
+		for uid, order := range cached {
+			report.CheckedCached++
+			current, ok := storedByUID[uid]
+			switch {
+			case !ok:
+				report.record(Drift{OrderUID: uid, Kind: DriftOrphaned, CachedVersion: order.Version})
+				if opts.Repair && s.cache.Delete(uid) {
+					report.Repaired++
+				}
+			case !sameRevision(order, current):
+				// the entry may have been updated by ingestion after it was read
+				if latest, ok := s.cache.Peek(uid); ok && !sameRevision(latest, order) {
+					continue
+				}
+				report.record(Drift{OrderUID: uid, Kind: DriftStale, CachedVersion: order.Version, StoredVersion: current.Version})
+				// LoadFromDB keeps an entry that ingestion made newer meanwhile
+				if opts.Repair {
+					s.cache.LoadFromDB([]models.Order{current})
+					report.Repaired++
+				}
+			}
+		}
+
+		if len(uids) < verifyBatchSize {
+			return nil
+		}
+	}
+}
+
+// verifyStored walks the database and reports orders that are not cached.
+func (s *orderService) verifyStored(ctx context.Context, opts VerifyOptions, report *VerificationReport) error {
+	it := s.repo.IterateOrders(repository.OrderFilter{}, verifyBatchSize)
+	for it.Next(ctx) {
+		var missing []models.Order
+		for _, order := range it.Orders() {
+			report.CheckedStored++
+			if _, ok := s.cache.Peek(order.OrderUID); ok {
+				continue
+			}
+			report.record(Drift{OrderUID: order.OrderUID, Kind: DriftMissing, StoredVersion: order.Version})
+			missing = append(missing, order)
+		}
+		if opts.Repair && len(missing) > 0 {
+			s.cache.LoadFromDB(missing)
+			report.Repaired += len(missing)
+		}
+	}
+	if err := it.Err(); err != nil {
+		return fmt.Errorf("failed to get orders: %w", err)
+	}
+	return nil
+}
+
+func sameRevision(a, b models.Order) bool {
+	return a.Version == b.Version && a.UpdatedAt.Equal(b.UpdatedAt)
+}
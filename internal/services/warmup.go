@@ -0,0 +1,70 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+type WarmupState string
+
+const (
+	WarmupPending WarmupState = "pending"
+	WarmupRunning WarmupState = "running"
+	WarmupDone    WarmupState = "done"
+	WarmupFailed  WarmupState = "failed"
+)
+
+type WarmupStatus struct {
+	State      WarmupState `json:"state"`
+	Loaded     int         `json:"loaded"`
+	Total      int         `json:"total"`
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt time.Time   `json:"finished_at"`
+	Error      string      `json:"error,omitempty"`
+}
+
+type warmupTracker struct {
+	mu     sync.RWMutex
+	status WarmupStatus
+}
+
+func newWarmupTracker() *warmupTracker {
+	return &warmupTracker{status: WarmupStatus{State: WarmupPending}}
+}
+
+func (t *warmupTracker) start(total int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status = WarmupStatus{
+		State:     WarmupRunning,
+		Total:     total,
+		StartedAt: time.Now(),
+	}
+}
+
+func (t *warmupTracker) progress(loaded int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.Loaded += loaded
+	if t.status.Loaded > t.status.Total {
+		t.status.Total = t.status.Loaded
+	}
+}
+
+func (t *warmupTracker) finish(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.FinishedAt = time.Now()
+	if err != nil {
+		t.status.State = WarmupFailed
+		t.status.Error = err.Error()
+		return
+	}
+	t.status.State = WarmupDone
+}
+
+func (t *warmupTracker) get() WarmupStatus {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.status
+}
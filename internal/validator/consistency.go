@@ -0,0 +1,133 @@
+package validator
+
+import (
+	"fmt"
+
+	"github.com/yokitheyo/wb_level0/internal/config"
+	"github.com/yokitheyo/wb_level0/internal/models"
+)
+
+// Rule codes of the consistency checks.
+const (
+	CodeGoodsTotalMismatch  = "goods_total_mismatch"
+	CodeTotalPriceMismatch  = "total_price_mismatch"
+	CodeAmountMismatch      = "amount_mismatch"
+	CodeTrackNumberMismatch = "track_number_mismatch"
+)
+
+// Mode decides what a failed rule does to the order.
+type Mode string
+
+const (
+	ModeOff Mode = "off"
+	// ModeWarn accepts the order and reports the violation as a warning.
+	ModeWarn   Mode = "warn"
+	ModeReject Mode = "reject"
+)
+
+func parseMode(name string) (Mode, error) {
+	switch Mode(name) {
+	case "", ModeOff:
+		return ModeOff, nil
+	case ModeWarn, ModeReject:
+		return Mode(name), nil
+	default:
+		return "", fmt.Errorf("unknown validation mode: %q", name)
+	}
+}
+
+// consistencyRules returns the consistency rules configured to reject and to
+// warn.
+func consistencyRules(cfg *config.ValidationConfig) (rules []Rule, warnings []Rule, err error) {
+	modes := []struct {
+		mode string
+		rule RuleFunc
+	}{
+		{cfg.GoodsTotal, checkGoodsTotal},
+		{cfg.ItemTotalPrice, checkItemTotalPrice},
+		{cfg.PaymentAmount, checkPaymentAmount},
+		{cfg.ItemTrackNumber, checkItemTrackNumber},
+	}
+	for _, m := range modes {
+		mode, err := parseMode(m.mode)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch mode {
+		case ModeWarn:
+			warnings = append(warnings, m.rule)
+		case ModeReject:
+			rules = append(rules, m.rule)
+		}
+	}
+	return rules, warnings, nil
+}
+
+// totalPriceTolerance absorbs the rounding of price with sale applied.
+const totalPriceTolerance = 1
+
+// checkGoodsTotal compares payment.goods_total with the sum of the items'
+// total_price.
+func checkGoodsTotal(order models.Order) []Violation {
+	sum := 0
+	for _, item := range order.Items {
+		sum += item.TotalPrice
+	}
+	if order.Payment.GoodsTotal == sum {
+		return nil
+	}
+	return []Violation{{
+		Path:    "payment.goods_total",
+		Code:    CodeGoodsTotalMismatch,
+		Message: fmt.Sprintf("must equal the sum of items total_price %d, got %d", sum, order.Payment.GoodsTotal),
+	}}
+}
+
+// checkItemTotalPrice compares total_price with price after the sale
+// percentage is taken off.
+func checkItemTotalPrice(order models.Order) []Violation {
+	var vs []Violation
+	for i, item := range order.Items {
+		expected := item.Price * (100 - item.Sale) / 100
+		diff := item.TotalPrice - expected
+		if diff >= -totalPriceTolerance && diff <= totalPriceTolerance {
+			continue
+		}
+		vs = append(vs, Violation{
+			Path:    fmt.Sprintf("items[%d].total_price", i),
+			Code:    CodeTotalPriceMismatch,
+			Message: fmt.Sprintf("must equal price %d with sale %d%% applied (%d), got %d", item.Price, item.Sale, expected, item.TotalPrice),
+		})
+	}
+	return vs
+}
+
+// checkPaymentAmount compares payment.amount with goods_total, delivery_cost
+// and custom_fee added up.
+func checkPaymentAmount(order models.Order) []Violation {
+	p := order.Payment
+	expected := p.GoodsTotal + p.DeliveryCost + p.CustomFee
+	if p.Amount == expected {
+		return nil
+	}
+	return []Violation{{
+		Path:    "payment.amount",
+		Code:    CodeAmountMismatch,
+		Message: fmt.Sprintf("must equal goods_total + delivery_cost + custom_fee %d, got %d", expected, p.Amount),
+	}}
+}
+
+func checkItemTrackNumber(order models.Order) []Violation {
+	var vs []Violation
+	for i, item := range order.Items {
+		if item.TrackNumber == "" || item.TrackNumber == order.TrackNumber {
+			continue
+		}
+		vs = append(vs, Violation{
+			Path:    fmt.Sprintf("items[%d].track_number", i),
+			Code:    CodeTrackNumberMismatch,
+			Message: fmt.Sprintf("must match the order track_number %q, got %q", order.TrackNumber, item.TrackNumber),
+		})
+	}
+	return vs
+}
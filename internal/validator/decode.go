@@ -0,0 +1,263 @@
+package validator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/yokitheyo/wb_level0/internal/config"
+	"github.com/yokitheyo/wb_level0/internal/models"
+)
+
+// Rule codes of the strict decoding checks.
+const (
+	CodeUnknownField = "unknown_field"
+	CodeInvalidType  = "invalid_type"
+	CodeTooLong      = "too_long"
+	CodeTooManyItems = "too_many_items"
+)
+
+// Decoder turns a JSON payload into an order. In strict mode the payload is
+// first checked against the order model, and every unknown field, value of
+// the wrong type and value over the size limits is reported at once.
+type Decoder struct {
+	strict          bool
+	unknownFields   Mode
+	maxItems        int
+	maxStringLength int
+}
+
+func NewDecoder(cfg *config.DecodingConfig) (*Decoder, error) {
+	mode, err := parseMode(cfg.UnknownFields)
+	if err != nil {
+		return nil, err
+	}
+	return &Decoder{
+		strict:          cfg.Strict,
+		unknownFields:   mode,
+		maxItems:        cfg.MaxItems,
+		maxStringLength: cfg.MaxStringLength,
+	}, nil
+}
+
+// NewLenientDecoder returns a decoder that behaves like json.Unmarshal.
+func NewLenientDecoder() *Decoder {
+	return &Decoder{unknownFields: ModeOff}
+}
+
+// Decode returns the order and the violations that are only reported, such
+// as unknown fields in warn mode. A payload that fails the strict checks is
+// rejected with Violations as the error.
+func (d *Decoder) Decode(data []byte) (models.Order, Violations, error) {
+	var order models.Order
+	if !d.strict {
+		return order, nil, json.Unmarshal(data, &order)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return order, nil, err
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return order, nil, fmt.Errorf("unexpected data after the order")
+	}
+
+	var warnings, violations Violations
+	d.walk(orderSchema, doc, "", func(v Violation) {
+		if v.Code == CodeUnknownField && d.unknownFields == ModeWarn {
+			warnings = append(warnings, v)
+			return
+		}
+		violations = append(violations, v)
+	})
+	if len(violations) > 0 {
+		return order, warnings, violations
+	}
+	return order, warnings, json.Unmarshal(data, &order)
+}
+
+type schemaKind int
+
+const (
+	kindObject schemaKind = iota
+	kindArray
+	kindString
+	kindInteger
+	kindNumber
+	kindBool
+	kindTimestamp
+)
+
+var kindNames = map[schemaKind]string{
+	kindObject:    "an object",
+	kindArray:     "an array",
+	kindString:    "a string",
+	kindInteger:   "an integer",
+	kindNumber:    "a number",
+	kindBool:      "a boolean",
+	kindTimestamp: "an RFC3339 UTC timestamp",
+}
+
+// schema describes the JSON form of a model type.
+type schema struct {
+	kind   schemaKind
+	fields map[string]*schema
+	elem   *schema
+}
+
+var orderSchema = schemaOf(reflect.TypeOf(models.Order{}))
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func schemaOf(t reflect.Type) *schema {
+	if t == timeType {
+		return &schema{kind: kindTimestamp}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		s := &schema{kind: kindObject, fields: make(map[string]*schema)}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if !f.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			s.fields[name] = schemaOf(f.Type)
+		}
+		return s
+	case reflect.Slice, reflect.Array:
+		return &schema{kind: kindArray, elem: schemaOf(t.Elem())}
+	case reflect.String:
+		return &schema{kind: kindString}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &schema{kind: kindInteger}
+	case reflect.Float32, reflect.Float64:
+		return &schema{kind: kindNumber}
+	case reflect.Bool:
+		return &schema{kind: kindBool}
+	default:
+		panic(fmt.Sprintf("unsupported order field type %s", t))
+	}
+}
+
+func (d *Decoder) walk(s *schema, value interface{}, path string, report func(Violation)) {
+	invalidType := func() {
+		report(Violation{Path: path, Code: CodeInvalidType, Message: fmt.Sprintf("must be %s, got %s", kindNames[s.kind], jsonType(value))})
+	}
+
+	switch s.kind {
+	case kindObject:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			invalidType()
+			return
+		}
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			v := obj[key]
+			field, ok := s.fields[key]
+			if !ok {
+				if d.unknownFields != ModeOff {
+					report(Violation{Path: joinPath(path, key), Code: CodeUnknownField, Message: "is not a known field"})
+				}
+				continue
+			}
+			d.walk(field, v, joinPath(path, key), report)
+		}
+	case kindArray:
+		list, ok := value.([]interface{})
+		if !ok {
+			invalidType()
+			return
+		}
+		if d.maxItems > 0 && len(list) > d.maxItems {
+			report(Violation{Path: path, Code: CodeTooManyItems, Message: fmt.Sprintf("must have at most %d elements, got %d", d.maxItems, len(list))})
+			return
+		}
+		for i, v := range list {
+			d.walk(s.elem, v, fmt.Sprintf("%s[%d]", path, i), report)
+		}
+	case kindString:
+		str, ok := value.(string)
+		if !ok {
+			invalidType()
+			return
+		}
+		if n := utf8.RuneCountInString(str); d.maxStringLength > 0 && n > d.maxStringLength {
+			report(Violation{Path: path, Code: CodeTooLong, Message: fmt.Sprintf("must be at most %d characters, got %d", d.maxStringLength, n)})
+		}
+	case kindInteger:
+		num, ok := value.(json.Number)
+		if !ok {
+			invalidType()
+			return
+		}
+		if _, err := num.Int64(); err != nil {
+			invalidType()
+		}
+	case kindNumber:
+		if _, ok := value.(json.Number); !ok {
+			invalidType()
+		}
+	case kindBool:
+		if _, ok := value.(bool); !ok {
+			invalidType()
+		}
+	case kindTimestamp:
+		str, ok := value.(string)
+		if !ok {
+			invalidType()
+			return
+		}
+		if _, err := time.Parse(time.RFC3339, str); err != nil || !strings.HasSuffix(str, "Z") {
+			report(Violation{Path: path, Code: CodeInvalidFormat, Message: fmt.Sprintf("must be an RFC3339 UTC timestamp like 2021-11-26T06:22:19Z, got %q", str)})
+		}
+	}
+}
+
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "an integer"
+		}
+		return "a number"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
@@ -0,0 +1,191 @@
+package validator
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/yokitheyo/wb_level0/internal/config"
+)
+
+// orderJSON returns validOrder as JSON after modify changed its generic form.
+func orderJSON(t *testing.T, modify func(doc map[string]interface{})) []byte {
+	t.Helper()
+	data, err := json.Marshal(validOrder())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	modify(doc)
+	if data, err = json.Marshal(doc); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func item(doc map[string]interface{}, i int) map[string]interface{} {
+	return doc["items"].([]interface{})[i].(map[string]interface{})
+}
+
+func TestStrictDecoder(t *testing.T) {
+	tests := []struct {
+		name          string
+		unknownFields string
+		modify        func(doc map[string]interface{})
+		wantWarnings  string
+		wantErr       string
+	}{
+		{
+			name:   "valid",
+			modify: func(doc map[string]interface{}) {},
+		},
+		{
+			name:          "unknown field ignored",
+			unknownFields: "off",
+			modify: func(doc map[string]interface{}) {
+				item(doc, 1)["colour"] = "red"
+			},
+		},
+		{
+			name:          "unknown field warns",
+			unknownFields: "warn",
+			modify: func(doc map[string]interface{}) {
+				item(doc, 1)["colour"] = "red"
+				doc["comment"] = "leave at the door"
+			},
+			wantWarnings: "comment unknown_field, items[1].colour unknown_field",
+		},
+		{
+			name:          "unknown field rejects",
+			unknownFields: "reject",
+			modify: func(doc map[string]interface{}) {
+				item(doc, 1)["colour"] = "red"
+			},
+			wantErr: "items[1].colour unknown_field",
+		},
+		{
+			name: "invalid type",
+			modify: func(doc map[string]interface{}) {
+				item(doc, 2)["price"] = "200"
+				item(doc, 0)["chrt_id"] = 1.5
+				doc["payment"].(map[string]interface{})["amount"] = nil
+				doc["delivery"] = []interface{}{}
+			},
+			wantErr: "delivery invalid_type, items[0].chrt_id invalid_type, items[2].price invalid_type, payment.amount invalid_type",
+		},
+		{
+			name: "too long",
+			modify: func(doc map[string]interface{}) {
+				item(doc, 2)["name"] = strings.Repeat("я", 65)
+			},
+			wantErr: "items[2].name too_long",
+		},
+		{
+			name: "limit counts characters",
+			modify: func(doc map[string]interface{}) {
+				item(doc, 2)["name"] = strings.Repeat("я", 64)
+			},
+		},
+		{
+			name: "too many items",
+			modify: func(doc map[string]interface{}) {
+				items := doc["items"].([]interface{})
+				doc["items"] = append(items, items[0], items[0])
+			},
+			wantErr: "items too_many_items",
+		},
+		{
+			name: "date_created with an offset",
+			modify: func(doc map[string]interface{}) {
+				doc["date_created"] = "2021-11-26T09:22:19+03:00"
+			},
+			wantErr: "date_created invalid_format",
+		},
+		{
+			name: "date_created without a zone",
+			modify: func(doc map[string]interface{}) {
+				doc["date_created"] = "2021-11-26 06:22:19"
+			},
+			wantErr: "date_created invalid_format",
+		},
+		{
+			name: "date_created not a string",
+			modify: func(doc map[string]interface{}) {
+				doc["date_created"] = 1637907739
+			},
+			wantErr: "date_created invalid_type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec, err := NewDecoder(&config.DecodingConfig{
+				Strict:          true,
+				UnknownFields:   tt.unknownFields,
+				MaxItems:        4,
+				MaxStringLength: 64,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			order, warnings, err := dec.Decode(orderJSON(t, tt.modify))
+			if got := violationSet(warnings); got != tt.wantWarnings {
+				t.Errorf("warnings = %q, want %q", got, tt.wantWarnings)
+			}
+			if _, ok := err.(Violations); err != nil && !ok {
+				t.Fatalf("Decode() error = %v, want Violations", err)
+			}
+			if got := violationSet(err); got != tt.wantErr {
+				t.Errorf("violations = %q, want %q", got, tt.wantErr)
+			}
+			if err == nil && order.OrderUID != validOrder().OrderUID {
+				t.Errorf("order_uid = %q, want %q", order.OrderUID, validOrder().OrderUID)
+			}
+		})
+	}
+}
+
+func TestStrictDecoderRejectsMalformedJSON(t *testing.T) {
+	dec, err := NewDecoder(&config.DecodingConfig{Strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := orderJSON(t, func(doc map[string]interface{}) {})
+
+	for name, data := range map[string][]byte{
+		"truncated":     valid[:len(valid)-1],
+		"trailing data": append(append([]byte{}, valid...), []byte(`{}`)...),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := dec.Decode(data); err == nil {
+				t.Fatal("Decode() accepted malformed JSON")
+			}
+		})
+	}
+}
+
+func TestLenientDecoderIgnoresStrictChecks(t *testing.T) {
+	data := orderJSON(t, func(doc map[string]interface{}) {
+		doc["comment"] = "leave at the door"
+		doc["date_created"] = "2021-11-26T09:22:19+03:00"
+		item(doc, 0)["name"] = strings.Repeat("я", 1000)
+	})
+
+	order, warnings, err := NewLenientDecoder().Decode(data)
+	if err != nil || len(warnings) != 0 {
+		t.Fatalf("Decode() = %v, %v, want no warnings and no error", warnings, err)
+	}
+	if !order.DateCreated.Equal(validOrder().DateCreated) {
+		t.Errorf("date_created = %v, want %v", order.DateCreated, validOrder().DateCreated)
+	}
+}
+
+func TestNewDecoderRejectsUnknownMode(t *testing.T) {
+	if _, err := NewDecoder(&config.DecodingConfig{Strict: true, UnknownFields: "ignore"}); err == nil {
+		t.Fatal("NewDecoder() accepted an unknown mode")
+	}
+}
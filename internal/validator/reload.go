@@ -0,0 +1,109 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/yokitheyo/wb_level0/internal/config"
+	"go.uber.org/zap"
+)
+
+// NewFromConfig returns a validator with the rules of cfg.RulesFile, or
+// DefaultRules if no file is set, followed by the consistency rules in their
+// configured modes.
+func NewFromConfig(cfg *config.ValidationConfig) (*Validator, error) {
+	v := &Validator{cfg: cfg}
+	set, modTime, err := loadRuleSet(cfg)
+	if err != nil {
+		return nil, err
+	}
+	v.set.Store(set)
+	v.rulesModTime = modTime
+	return v, nil
+}
+
+// Reload replaces the rule set if the rules file changed since it was last
+// loaded. It reports whether the rules were replaced; on error the current
+// rules stay in place. Reload must not be called concurrently.
+func (v *Validator) Reload() (bool, error) {
+	if v.cfg == nil || v.cfg.RulesFile == "" {
+		return false, nil
+	}
+
+	info, err := os.Stat(v.cfg.RulesFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat rules file: %w", err)
+	}
+	if info.ModTime().Equal(v.rulesModTime) {
+		return false, nil
+	}
+
+	set, modTime, err := loadRuleSet(v.cfg)
+	if err != nil {
+		// don't retry the same broken file on every tick
+		v.rulesModTime = info.ModTime()
+		return false, err
+	}
+	v.set.Store(set)
+	v.rulesModTime = modTime
+	return true, nil
+}
+
+func loadRuleSet(cfg *config.ValidationConfig) (*ruleSet, time.Time, error) {
+	set := &ruleSet{}
+	var modTime time.Time
+
+	if cfg.RulesFile == "" {
+		set.rules = DefaultRules()
+	} else {
+		info, err := os.Stat(cfg.RulesFile)
+		if err != nil {
+			return nil, modTime, fmt.Errorf("failed to stat rules file: %w", err)
+		}
+		modTime = info.ModTime()
+
+		if set.rules, set.warnings, err = LoadRuleFile(cfg.RulesFile); err != nil {
+			return nil, modTime, err
+		}
+	}
+
+	rules, warnings, err := consistencyRules(cfg)
+	if err != nil {
+		return nil, modTime, err
+	}
+	set.rules = append(set.rules, rules...)
+	set.warnings = append(set.warnings, warnings...)
+	return set, modTime, nil
+}
+
+// RunReloader checks the rules file of v for changes every interval until
+// ctx is cancelled.
+func RunReloader(ctx context.Context, v *Validator, interval time.Duration, logger *zap.Logger) {
+	if interval <= 0 || v.cfg == nil || v.cfg.RulesFile == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := v.Reload()
+			if err != nil {
+				logger.Error("failed to reload validation rules, keeping the current ones",
+					zap.Error(err),
+					zap.String("path", v.cfg.RulesFile),
+				)
+				continue
+			}
+			if reloaded {
+				logger.Info("validation rules reloaded", zap.String("path", v.cfg.RulesFile))
+			}
+		}
+	}
+}
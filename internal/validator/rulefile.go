@@ -0,0 +1,258 @@
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/yokitheyo/wb_level0/internal/models"
+	"gopkg.in/yaml.v3"
+)
+
+// Rule codes of the rules file checks.
+const (
+	CodeOutOfRange = "out_of_range"
+	CodeNotAllowed = "not_allowed"
+)
+
+// FieldRule is one entry of a rules file. Path uses the order's JSON field
+// names, where "[]" matches every element of an array, e.g. "items[].price".
+// Empty values ("", null, missing fields and empty arrays) only fail
+// Required; the other checks apply to values that are set.
+type FieldRule struct {
+	Path     string   `yaml:"path"`
+	Required bool     `yaml:"required"`
+	Pattern  string   `yaml:"pattern"`
+	Min      *float64 `yaml:"min"`
+	Max      *float64 `yaml:"max"`
+	Enum     []string `yaml:"enum"`
+	// Mode is "reject" (the default) or "warn".
+	Mode Mode `yaml:"mode"`
+	// Code and Message replace the reported defaults.
+	Code    string `yaml:"code"`
+	Message string `yaml:"message"`
+}
+
+type RuleFile struct {
+	Rules []FieldRule `yaml:"rules"`
+}
+
+type fieldRule struct {
+	FieldRule
+	segments []string
+	pattern  *regexp.Regexp
+}
+
+// fieldRules checks an order against a list of field rules; the order is
+// converted to its JSON form once for all of them.
+type fieldRules []fieldRule
+
+func (rs fieldRules) Check(order models.Order) []Violation {
+	doc, err := orderDocument(order)
+	if err != nil {
+		return []Violation{{Path: "", Code: CodeInvalidFormat, Message: err.Error()}}
+	}
+
+	var vs []Violation
+	for _, r := range rs {
+		resolve(doc, r.segments, "", func(path string, value interface{}) {
+			if v, ok := r.check(path, value); !ok {
+				vs = append(vs, v)
+			}
+		})
+	}
+	return vs
+}
+
+// LoadRuleFile reads a rules file and returns its reject and warn rules.
+// Paths are checked against the order model, so that a typo fails the load
+// instead of silently matching nothing.
+func LoadRuleFile(path string) (rules []Rule, warnings []Rule, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read rules file: %w", err)
+	}
+
+	var file RuleFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse rules file: %w", err)
+	}
+
+	sample, err := orderDocument(models.Order{Items: []models.Item{{}}})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var reject, warn fieldRules
+	for i, fr := range file.Rules {
+		r, err := compileFieldRule(fr, sample)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid rule %d (%s): %w", i, fr.Path, err)
+		}
+		switch r.Mode {
+		case ModeWarn:
+			warn = append(warn, r)
+		case ModeReject:
+			reject = append(reject, r)
+		}
+	}
+
+	if len(reject) > 0 {
+		rules = []Rule{reject}
+	}
+	if len(warn) > 0 {
+		warnings = []Rule{warn}
+	}
+	return rules, warnings, nil
+}
+
+func compileFieldRule(fr FieldRule, sample interface{}) (fieldRule, error) {
+	r := fieldRule{FieldRule: fr, segments: strings.Split(fr.Path, ".")}
+	if fr.Path == "" {
+		return r, fmt.Errorf("path is required")
+	}
+
+	switch fr.Mode {
+	case "":
+		r.Mode = ModeReject
+	case ModeOff, ModeWarn, ModeReject:
+	default:
+		return r, fmt.Errorf("unknown validation mode: %q", fr.Mode)
+	}
+
+	if fr.Pattern != "" {
+		re, err := regexp.Compile(fr.Pattern)
+		if err != nil {
+			return r, fmt.Errorf("invalid pattern: %w", err)
+		}
+		r.pattern = re
+	}
+	if fr.Min != nil && fr.Max != nil && *fr.Min > *fr.Max {
+		return r, fmt.Errorf("min %v is greater than max %v", *fr.Min, *fr.Max)
+	}
+
+	found := false
+	var typeErr error
+	resolve(sample, r.segments, "", func(_ string, value interface{}) {
+		if value == nil {
+			return
+		}
+		found = true
+		_, isString := value.(string)
+		_, isNumber := value.(float64)
+		switch {
+		case (r.pattern != nil || len(fr.Enum) > 0) && !isString:
+			typeErr = fmt.Errorf("pattern and enum apply to string fields only")
+		case (fr.Min != nil || fr.Max != nil) && !isNumber:
+			typeErr = fmt.Errorf("min and max apply to numeric fields only")
+		}
+	})
+	if !found {
+		return r, fmt.Errorf("unknown field")
+	}
+	return r, typeErr
+}
+
+// check reports whether value passes the rule, and the violation if not.
+func (r fieldRule) check(path string, value interface{}) (Violation, bool) {
+	if isEmpty(value) {
+		if r.Required {
+			return r.violation(path, CodeRequired, "is required"), false
+		}
+		return Violation{}, true
+	}
+
+	switch v := value.(type) {
+	case string:
+		if r.pattern != nil && !r.pattern.MatchString(v) {
+			return r.violation(path, CodeInvalidFormat, fmt.Sprintf("must match %q", r.Pattern)), false
+		}
+		if len(r.Enum) > 0 && !contains(r.Enum, v) {
+			return r.violation(path, CodeNotAllowed, fmt.Sprintf("must be one of %s, got %q", strings.Join(r.Enum, ", "), v)), false
+		}
+	case float64:
+		if r.Min != nil && v < *r.Min {
+			return r.violation(path, CodeOutOfRange, fmt.Sprintf("must be at least %v, got %v", *r.Min, v)), false
+		}
+		if r.Max != nil && v > *r.Max {
+			return r.violation(path, CodeOutOfRange, fmt.Sprintf("must be at most %v, got %v", *r.Max, v)), false
+		}
+	}
+	return Violation{}, true
+}
+
+func (r fieldRule) violation(path, code, message string) Violation {
+	if r.Code != "" {
+		code = r.Code
+	}
+	if r.Message != "" {
+		message = r.Message
+	}
+	return Violation{Path: path, Code: code, Message: message}
+}
+
+// resolve calls fn with every value segments lead to in doc, and with nil for
+// the ones that are missing.
+func resolve(doc interface{}, segments []string, prefix string, fn func(path string, value interface{})) {
+	if len(segments) == 0 {
+		fn(prefix, doc)
+		return
+	}
+
+	key, each := strings.CutSuffix(segments[0], "[]")
+	path := key
+	if prefix != "" {
+		path = prefix + "." + key
+	}
+
+	obj, _ := doc.(map[string]interface{})
+	value, ok := obj[key]
+	if !ok || !each {
+		resolve(value, segments[1:], path, fn)
+		return
+	}
+
+	list, ok := value.([]interface{})
+	if !ok {
+		fn(path, nil)
+		return
+	}
+	for i, elem := range list {
+		resolve(elem, segments[1:], fmt.Sprintf("%s[%d]", path, i), fn)
+	}
+}
+
+func orderDocument(order models.Order) (interface{}, error) {
+	data, err := json.Marshal(order)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal order: %w", err)
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal order: %w", err)
+	}
+	return doc, nil
+}
+
+func isEmpty(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+func contains(values []string, v string) bool {
+	for _, candidate := range values {
+		if candidate == v {
+			return true
+		}
+	}
+	return false
+}
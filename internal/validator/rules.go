@@ -0,0 +1,70 @@
+package validator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yokitheyo/wb_level0/internal/models"
+)
+
+// DefaultRules are the presence and format checks every order has to pass.
+func DefaultRules() []Rule {
+	return []Rule{
+		RuleFunc(checkOrder),
+		RuleFunc(checkDelivery),
+		RuleFunc(checkPayment),
+		RuleFunc(checkItems),
+	}
+}
+
+func checkOrder(order models.Order) []Violation {
+	var vs []Violation
+	vs = append(vs, required("order_uid", order.OrderUID)...)
+	vs = append(vs, required("track_number", order.TrackNumber)...)
+	vs = append(vs, required("entry", order.Entry)...)
+	vs = append(vs, required("customer_id", order.CustomerID)...)
+	vs = append(vs, required("delivery_service", order.DeliveryService)...)
+	return vs
+}
+
+func checkDelivery(order models.Order) []Violation {
+	d := order.Delivery
+	var vs []Violation
+	vs = append(vs, required("delivery.name", d.Name)...)
+	vs = append(vs, required("delivery.phone", d.Phone)...)
+	vs = append(vs, required("delivery.city", d.City)...)
+	vs = append(vs, required("delivery.address", d.Address)...)
+	if d.Email != "" && !strings.Contains(d.Email, "@") {
+		vs = append(vs, Violation{Path: "delivery.email", Code: CodeInvalidFormat, Message: "invalid email format"})
+	}
+	return vs
+}
+
+func checkPayment(order models.Order) []Violation {
+	p := order.Payment
+	var vs []Violation
+	vs = append(vs, required("payment.transaction", p.Transaction)...)
+	vs = append(vs, required("payment.currency", p.Currency)...)
+	vs = append(vs, required("payment.provider", p.Provider)...)
+	vs = append(vs, positive("payment.amount", p.Amount)...)
+	vs = append(vs, required("payment.bank", p.Bank)...)
+	return vs
+}
+
+func checkItems(order models.Order) []Violation {
+	if len(order.Items) == 0 {
+		return []Violation{{Path: "items", Code: CodeRequired, Message: "must contain at least one item"}}
+	}
+
+	var vs []Violation
+	for i, item := range order.Items {
+		prefix := fmt.Sprintf("items[%d].", i)
+		vs = append(vs, positive(prefix+"chrt_id", item.ChrtID)...)
+		vs = append(vs, required(prefix+"track_number", item.TrackNumber)...)
+		vs = append(vs, required(prefix+"name", item.Name)...)
+		vs = append(vs, positive(prefix+"price", item.Price)...)
+		vs = append(vs, positive(prefix+"total_price", item.TotalPrice)...)
+		vs = append(vs, required(prefix+"brand", item.Brand)...)
+	}
+	return vs
+}
@@ -0,0 +1,146 @@
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/yokitheyo/wb_level0/internal/models"
+	"gopkg.in/yaml.v3"
+)
+
+// SampleFile is a table of orders with the violations each is expected to
+// produce. Every case's order is merged over Base: maps are merged key by
+// key, array elements by index, and an empty array replaces the base one.
+type SampleFile struct {
+	Base  map[string]interface{} `yaml:"base"`
+	Cases []SampleCase           `yaml:"cases"`
+}
+
+type SampleCase struct {
+	Name       string                 `yaml:"name"`
+	Order      map[string]interface{} `yaml:"order"`
+	Violations []ExpectedViolation    `yaml:"violations"`
+	Warnings   []ExpectedViolation    `yaml:"warnings"`
+}
+
+type ExpectedViolation struct {
+	Path string `yaml:"path"`
+	Code string `yaml:"code"`
+}
+
+func (e ExpectedViolation) String() string {
+	return e.Path + " " + e.Code
+}
+
+// SampleResult is the outcome of one case. Missing lists the expected
+// violations that were not reported, Unexpected the reported ones that were
+// not expected.
+type SampleResult struct {
+	Name       string
+	Missing    []string
+	Unexpected []string
+}
+
+func (r SampleResult) Passed() bool {
+	return len(r.Missing) == 0 && len(r.Unexpected) == 0
+}
+
+func LoadSampleFile(path string) (SampleFile, error) {
+	var file SampleFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return file, fmt.Errorf("failed to read samples file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return file, fmt.Errorf("failed to parse samples file: %w", err)
+	}
+	return file, nil
+}
+
+// RunSamples validates every case of file and compares the reported
+// violations and warnings, by path and code, with the expected ones.
+func (v *Validator) RunSamples(file SampleFile) ([]SampleResult, error) {
+	results := make([]SampleResult, 0, len(file.Cases))
+	for i, c := range file.Cases {
+		order, err := sampleOrder(file.Base, c.Order)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sample %d (%s): %w", i, c.Name, err)
+		}
+
+		warnings, err := v.Validate(order)
+		violations, _ := err.(Violations)
+
+		result := SampleResult{Name: c.Name}
+		compareViolations(&result, "", c.Violations, violations)
+		compareViolations(&result, "warning ", c.Warnings, warnings)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func compareViolations(result *SampleResult, kind string, expected []ExpectedViolation, reported Violations) {
+	want := make(map[string]int, len(expected))
+	for _, e := range expected {
+		want[e.String()]++
+	}
+	for _, v := range reported {
+		key := ExpectedViolation{Path: v.Path, Code: v.Code}.String()
+		if want[key] > 0 {
+			want[key]--
+			continue
+		}
+		result.Unexpected = append(result.Unexpected, kind+key)
+	}
+	for key, n := range want {
+		for ; n > 0; n-- {
+			result.Missing = append(result.Missing, kind+key)
+		}
+	}
+	sort.Strings(result.Missing)
+	sort.Strings(result.Unexpected)
+}
+
+func sampleOrder(base, patch map[string]interface{}) (models.Order, error) {
+	var order models.Order
+	data, err := json.Marshal(merge(base, patch))
+	if err != nil {
+		return order, fmt.Errorf("failed to marshal order: %w", err)
+	}
+	if err := json.Unmarshal(data, &order); err != nil {
+		return order, fmt.Errorf("failed to unmarshal order: %w", err)
+	}
+	return order, nil
+}
+
+func merge(base, patch interface{}) interface{} {
+	switch p := patch.(type) {
+	case map[string]interface{}:
+		b, ok := base.(map[string]interface{})
+		if !ok {
+			return p
+		}
+		merged := make(map[string]interface{}, len(b))
+		for k, v := range b {
+			merged[k] = v
+		}
+		for k, v := range p {
+			merged[k] = merge(b[k], v)
+		}
+		return merged
+	case []interface{}:
+		b, ok := base.([]interface{})
+		if !ok || len(p) == 0 {
+			return p
+		}
+		merged := make([]interface{}, max(len(b), len(p)))
+		copy(merged, b)
+		for i, v := range p {
+			merged[i] = merge(merged[i], v)
+		}
+		return merged
+	default:
+		return patch
+	}
+}
@@ -0,0 +1,85 @@
+package validator
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/yokitheyo/wb_level0/internal/config"
+)
+
+// TestShippedSamples runs config/validation_samples.yaml against the shipped
+// config and rules file, like "go run ./cmd check-rules".
+func TestShippedSamples(t *testing.T) {
+	cfg, err := config.LoadConfig("../../config/config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Validation.RulesFile = "../../config/validation.yaml"
+
+	v, err := NewFromConfig(&cfg.Validation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples, err := LoadSampleFile("../../config/validation_samples.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := v.RunSamples(samples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if !r.Passed() {
+			t.Errorf("%s: missing %v, unexpected %v", r.Name, r.Missing, r.Unexpected)
+		}
+	}
+}
+
+// TestShippedRulesRejectLikeBuiltIn checks that the shipped rules file
+// rejects the sample orders exactly like the built-in rules; it may only add
+// warnings.
+func TestShippedRulesRejectLikeBuiltIn(t *testing.T) {
+	cfg, err := config.LoadConfig("../../config/config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	builtInCfg := cfg.Validation
+	builtInCfg.RulesFile = ""
+	builtIn, err := NewFromConfig(&builtInCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shippedCfg := cfg.Validation
+	shippedCfg.RulesFile = "../../config/validation.yaml"
+	shipped, err := NewFromConfig(&shippedCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	samples, err := LoadSampleFile("../../config/validation_samples.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range samples.Cases {
+		order, err := sampleOrder(samples.Base, c.Order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, want := builtIn.Validate(order)
+		_, got := shipped.Validate(order)
+		if violationSet(got) != violationSet(want) {
+			t.Errorf("%s: shipped rules reject %q, built-in rules reject %q", c.Name, violationSet(got), violationSet(want))
+		}
+	}
+}
+
+func violationSet(err error) string {
+	vs, _ := err.(Violations)
+	keys := make([]string, len(vs))
+	for i, v := range vs {
+		keys[i] = v.Path + " " + v.Code
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ", ")
+}
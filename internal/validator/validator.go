@@ -0,0 +1,119 @@
+package validator
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/yokitheyo/wb_level0/internal/config"
+	"github.com/yokitheyo/wb_level0/internal/models"
+)
+
+// Rule codes reported in Violation.Code.
+const (
+	CodeRequired      = "required"
+	CodePositive      = "positive"
+	CodeInvalidFormat = "invalid_format"
+)
+
+// Violation is one failed check. Path locates the field in the order's JSON,
+// e.g. "items[2].price".
+type Violation struct {
+	Path    string `json:"path"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	if v.Path == "" {
+		return v.Message
+	}
+	return v.Path + ": " + v.Message
+}
+
+// Violations is returned as the error of a failed validation.
+type Violations []Violation
+
+func (vs Violations) Error() string {
+	parts := make([]string, len(vs))
+	for i, v := range vs {
+		parts[i] = v.String()
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Rule checks one aspect of an order and reports every violation it finds.
+type Rule interface {
+	Check(order models.Order) []Violation
+}
+
+// RuleFunc adapts a function to Rule.
+type RuleFunc func(order models.Order) []Violation
+
+func (f RuleFunc) Check(order models.Order) []Violation {
+	return f(order)
+}
+
+// Validator runs every rule of its rule set instead of stopping at the first
+// failure, so producers see all problems of an order at once. The rule set
+// can be replaced while orders are being validated.
+type Validator struct {
+	set atomic.Pointer[ruleSet]
+
+	// cfg and rulesModTime are used by Reload.
+	cfg          *config.ValidationConfig
+	rulesModTime time.Time
+}
+
+type ruleSet struct {
+	rules []Rule
+	// warnings are rules whose violations are reported but do not reject
+	// the order.
+	warnings []Rule
+}
+
+func New(rules ...Rule) *Validator {
+	v := &Validator{}
+	v.set.Store(&ruleSet{rules: rules})
+	return v
+}
+
+// NewDefault returns a validator with DefaultRules.
+func NewDefault() *Validator {
+	return New(DefaultRules()...)
+}
+
+// Validate returns the violations of the warning rules, and an error if the
+// order fails any other rule.
+func (v *Validator) Validate(order models.Order) (Violations, error) {
+	set := v.set.Load()
+
+	var warnings Violations
+	for _, rule := range set.warnings {
+		warnings = append(warnings, rule.Check(order)...)
+	}
+
+	var violations Violations
+	for _, rule := range set.rules {
+		violations = append(violations, rule.Check(order)...)
+	}
+	if len(violations) > 0 {
+		return warnings, violations
+	}
+	return warnings, nil
+}
+
+func required(path, value string) []Violation {
+	if value != "" {
+		return nil
+	}
+	return []Violation{{Path: path, Code: CodeRequired, Message: "is required"}}
+}
+
+func positive(path string, value int) []Violation {
+	if value > 0 {
+		return nil
+	}
+	return []Violation{{Path: path, Code: CodePositive, Message: fmt.Sprintf("must be positive, got %d", value)}}
+}
@@ -0,0 +1,281 @@
+package validator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yokitheyo/wb_level0/internal/config"
+	"github.com/yokitheyo/wb_level0/internal/models"
+)
+
+// validOrder passes the built-in rules and every consistency rule.
+func validOrder() models.Order {
+	item := func(chrtID int) models.Item {
+		return models.Item{
+			ChrtID:      chrtID,
+			TrackNumber: "WBILMTESTTRACK",
+			Price:       200,
+			RID:         "rid",
+			Name:        "Mascaras",
+			Sale:        30,
+			Size:        "0",
+			TotalPrice:  140,
+			NmID:        2389212,
+			Brand:       "Vivienne Sabo",
+			Status:      202,
+		}
+	}
+	return models.Order{
+		OrderUID:        "b563feb7b2b84b6test",
+		TrackNumber:     "WBILMTESTTRACK",
+		Entry:           "WBIL",
+		CustomerID:      "test",
+		DeliveryService: "meest",
+		Delivery: models.Delivery{
+			Name:    "Test Testov",
+			Phone:   "+9720000000",
+			City:    "Kiryat Mozkin",
+			Address: "Ploshad Mira 15",
+			Email:   "test@gmail.com",
+		},
+		Payment: models.Payment{
+			Transaction:  "b563feb7b2b84b6test",
+			Currency:     "USD",
+			Provider:     "wbpay",
+			Amount:       1920,
+			Bank:         "alpha",
+			DeliveryCost: 1500,
+			GoodsTotal:   420,
+		},
+		Items:       []models.Item{item(1), item(2), item(3)},
+		DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+	}
+}
+
+func TestValidateReportsEveryViolation(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(o *models.Order)
+		want   string
+	}{
+		{
+			name:   "valid",
+			modify: func(o *models.Order) {},
+			want:   "",
+		},
+		{
+			name:   "item path",
+			modify: func(o *models.Order) { o.Items[2].Price = 0 },
+			want:   "items[2].price positive",
+		},
+		{
+			name: "several fields",
+			modify: func(o *models.Order) {
+				o.OrderUID = ""
+				o.Delivery.Email = "test.gmail.com"
+				o.Payment.Amount = -1
+				o.Items[1].Brand = ""
+			},
+			want: "delivery.email invalid_format, items[1].brand required, order_uid required, payment.amount positive",
+		},
+		{
+			name:   "no items",
+			modify: func(o *models.Order) { o.Items = nil },
+			want:   "items required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := validOrder()
+			tt.modify(&order)
+
+			warnings, err := NewDefault().Validate(order)
+			if len(warnings) != 0 {
+				t.Errorf("warnings = %v, want none", warnings)
+			}
+			if got := violationSet(err); got != tt.want {
+				t.Errorf("violations = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConsistencyModes(t *testing.T) {
+	order := validOrder()
+	order.Payment.GoodsTotal = 400
+	order.Payment.Amount = 1900
+	order.Items[1].TotalPrice = 160
+	order.Items[2].TrackNumber = "OTHERTRACK"
+
+	tests := []struct {
+		mode         string
+		wantWarnings string
+		wantErr      string
+	}{
+		{
+			mode: "off",
+		},
+		{
+			mode:         "warn",
+			wantWarnings: "items[1].total_price total_price_mismatch, items[2].track_number track_number_mismatch, payment.goods_total goods_total_mismatch",
+		},
+		{
+			mode:    "reject",
+			wantErr: "items[1].total_price total_price_mismatch, items[2].track_number track_number_mismatch, payment.goods_total goods_total_mismatch",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			v, err := NewFromConfig(&config.ValidationConfig{
+				GoodsTotal:      tt.mode,
+				ItemTotalPrice:  tt.mode,
+				PaymentAmount:   tt.mode,
+				ItemTrackNumber: tt.mode,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			warnings, err := v.Validate(order)
+			if got := violationSet(warnings); got != tt.wantWarnings {
+				t.Errorf("warnings = %q, want %q", got, tt.wantWarnings)
+			}
+			if got := violationSet(err); got != tt.wantErr {
+				t.Errorf("violations = %q, want %q", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewFromConfigRejectsUnknownMode(t *testing.T) {
+	if _, err := NewFromConfig(&config.ValidationConfig{GoodsTotal: "strict"}); err == nil {
+		t.Fatal("NewFromConfig() accepted an unknown mode")
+	}
+}
+
+func writeRules(t *testing.T, rules string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "validation.yaml")
+	if err := os.WriteFile(path, []byte(rules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRuleFile(t *testing.T) {
+	path := writeRules(t, `
+rules:
+  - path: items[].price
+    min: 1
+  - path: items[].sale
+    max: 100
+    mode: warn
+  - path: payment.currency
+    enum: [USD, RUB]
+    code: unsupported_currency
+    message: is not a supported currency
+  - path: delivery.phone
+    pattern: '^\+[0-9]{10,15}$'
+  - path: locale
+    required: true
+    mode: warn
+  - path: order_uid
+    mode: off
+    required: true
+`)
+
+	order := validOrder()
+	order.OrderUID = ""
+	order.Items[2].Price = 0
+	order.Items[1].Sale = 120
+	order.Payment.Currency = "EUR"
+	order.Delivery.Phone = "0000"
+
+	v, err := NewFromConfig(&config.ValidationConfig{RulesFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	warnings, err := v.Validate(order)
+
+	if got, want := violationSet(warnings), "items[1].sale out_of_range, locale required"; got != want {
+		t.Errorf("warnings = %q, want %q", got, want)
+	}
+	if got, want := violationSet(err), "delivery.phone invalid_format, items[2].price out_of_range, payment.currency unsupported_currency"; got != want {
+		t.Errorf("violations = %q, want %q", got, want)
+	}
+	vs, _ := err.(Violations)
+	for _, v := range vs {
+		if v.Code == "unsupported_currency" && v.Message != "is not a supported currency" {
+			t.Errorf("message = %q, want the configured one", v.Message)
+		}
+	}
+}
+
+func TestLoadRuleFileRejectsInvalidRules(t *testing.T) {
+	tests := map[string]string{
+		"unknown path":    "rules:\n  - path: items[].prize\n    min: 1\n",
+		"missing path":    "rules:\n  - min: 1\n",
+		"unknown mode":    "rules:\n  - path: locale\n    required: true\n    mode: strict\n",
+		"invalid pattern": "rules:\n  - path: locale\n    pattern: '['\n",
+		"invalid yaml":    "rules: [",
+	}
+
+	for name, rules := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := LoadRuleFile(writeRules(t, rules)); err == nil {
+				t.Fatal("LoadRuleFile() accepted an invalid rules file")
+			}
+		})
+	}
+}
+
+func TestReloadKeepsRulesOnError(t *testing.T) {
+	path := writeRules(t, "rules:\n  - path: locale\n    required: true\n")
+	v, err := NewFromConfig(&config.ValidationConfig{RulesFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := validOrder()
+
+	if _, err := v.Validate(order); violationSet(err) != "locale required" {
+		t.Fatalf("violations = %q, want locale required", violationSet(err))
+	}
+
+	// a broken file keeps the loaded rules
+	writeRulesAt(t, path, "rules: [", time.Now().Add(time.Second))
+	if _, err := v.Reload(); err == nil {
+		t.Fatal("Reload() accepted an invalid rules file")
+	}
+	if _, err := v.Validate(order); violationSet(err) != "locale required" {
+		t.Fatalf("violations after a failed reload = %q, want locale required", violationSet(err))
+	}
+
+	writeRulesAt(t, path, "rules:\n  - path: entry\n    enum: [WBIL]\n", time.Now().Add(2*time.Second))
+	reloaded, err := v.Reload()
+	if err != nil || !reloaded {
+		t.Fatalf("Reload() = %v, %v, want true, nil", reloaded, err)
+	}
+	if _, err := v.Validate(order); err != nil {
+		t.Fatalf("Validate() after reload = %v, want nil", err)
+	}
+
+	if reloaded, err := v.Reload(); err != nil || reloaded {
+		t.Fatalf("Reload() of an unchanged file = %v, %v, want false, nil", reloaded, err)
+	}
+}
+
+// writeRulesAt replaces a rules file and sets its modification time, since
+// two writes within the file system's timestamp resolution look unchanged.
+func writeRulesAt(t *testing.T, path, rules string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(rules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
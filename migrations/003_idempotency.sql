@@ -0,0 +1,13 @@
+DELETE FROM items a
+    USING items b
+WHERE a.id > b.id
+  AND a.order_uid = b.order_uid
+  AND a.chrt_id = b.chrt_id
+  AND a.rid = b.rid;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_items_order_uid_chrt_id_rid ON items(order_uid, chrt_id, rid);
+
+CREATE TABLE IF NOT EXISTS processed_messages (
+    message_key VARCHAR(255) PRIMARY KEY,
+    processed_at TIMESTAMP NOT NULL DEFAULT NOW()
+    );
@@ -0,0 +1 @@
+ALTER TABLE processed_messages ADD COLUMN IF NOT EXISTS schema_version VARCHAR(64);
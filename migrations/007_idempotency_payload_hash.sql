@@ -0,0 +1 @@
+ALTER TABLE processed_messages ADD COLUMN IF NOT EXISTS payload_hash VARCHAR(64);
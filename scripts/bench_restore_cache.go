@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/yokitheyo/wb_level0/internal/cache"
+	"github.com/yokitheyo/wb_level0/internal/config"
+	"github.com/yokitheyo/wb_level0/internal/models"
+	"github.com/yokitheyo/wb_level0/internal/repository"
+	"github.com/yokitheyo/wb_level0/internal/services"
+	"github.com/yokitheyo/wb_level0/internal/validator"
+	"go.uber.org/zap"
+)
+
+var schemaName = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// The benchmark seeds its orders into a schema of its own, so the orders of
+// the configured database are never touched. The schema is dropped at the
+// end unless -keep is set, in which case the next run reuses the orders.
+func main() {
+	configPath := flag.String("config", "config/config.yaml", "path to config file")
+	numOrders := flag.Int("n", 100000, "number of orders to seed")
+	batchSize := flag.Int("batch", 1000, "orders per insert transaction")
+	schema := flag.String("schema", "bench_restore", "schema the orders are seeded into")
+	migrations := flag.String("migrations", "migrations", "directory with the migration files")
+	keep := flag.Bool("keep", false, "keep the schema and its orders for the next run")
+	compare := flag.Bool("compare", true, "also time the per-order restore used before set-based reads")
+	flag.Parse()
+
+	if !schemaName.MatchString(*schema) || *schema == "public" {
+		log.Fatalf("invalid schema %q: use a dedicated lowercase schema name", *schema)
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+
+	ctx := context.Background()
+	dbURL := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
+		cfg.Database.User, cfg.Database.Password, cfg.Database.Host, cfg.Database.Port, cfg.Database.DBName, cfg.Database.SSLMode,
+	)
+	admin, err := pgxpool.Connect(ctx, dbURL)
+	if err != nil {
+		log.Fatalf("failed to connect to database: %v", err)
+	}
+	defer admin.Close()
+
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA IF NOT EXISTS "+*schema); err != nil {
+		log.Fatalf("failed to create schema: %v", err)
+	}
+	err = run(ctx, dbURL, *schema, *migrations, *numOrders, *batchSize, *compare)
+
+	if !*keep {
+		if _, dropErr := admin.Exec(ctx, "DROP SCHEMA "+*schema+" CASCADE"); dropErr != nil {
+			log.Printf("failed to drop schema %s: %v", *schema, dropErr)
+		} else {
+			fmt.Printf("Схема %s удалена\n", *schema)
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, dbURL, schema, migrations string, numOrders, batchSize int, compare bool) error {
+	poolCfg, err := pgxpool.ParseConfig(dbURL)
+	if err != nil {
+		return fmt.Errorf("failed to parse database url: %w", err)
+	}
+	poolCfg.ConnConfig.RuntimeParams["search_path"] = schema
+	pool, err := pgxpool.ConnectConfig(ctx, poolCfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer pool.Close()
+
+	// every migration is idempotent, so a kept schema is migrated again
+	files, err := filepath.Glob(filepath.Join(migrations, "*.sql"))
+	if err != nil || len(files) == 0 {
+		return fmt.Errorf("no migrations found in %s", migrations)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		sql, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read migration: %w", err)
+		}
+		if _, err := pool.Exec(ctx, string(sql)); err != nil {
+			return fmt.Errorf("failed to apply %s: %w", file, err)
+		}
+	}
+
+	logger := zap.NewNop()
+	repo := repository.NewOrderRepository(pool, logger)
+
+	var existing int
+	if err := pool.QueryRow(ctx, "SELECT count(*) FROM orders").Scan(&existing); err != nil {
+		return fmt.Errorf("failed to count seeded orders: %w", err)
+	}
+
+	fmt.Printf("Заполняем схему %s: %d заказов (уже есть %d)\n", schema, numOrders, existing)
+	start := time.Now()
+	for i := existing; i < numOrders; i += batchSize {
+		n := min(batchSize, numOrders-i)
+		orders := make([]models.Order, n)
+		for j := range orders {
+			orders[j] = benchOrder(i + j)
+		}
+		if _, err := repo.SaveOrders(ctx, orders); err != nil {
+			return fmt.Errorf("failed to seed orders: %w", err)
+		}
+	}
+	fmt.Printf("Заполнение заняло %v\n\n", time.Since(start))
+
+	if compare {
+		c := cache.NewOrderCache(logger)
+		m, err := measure(func() error { return restorePerOrder(ctx, pool, c) })
+		if err != nil {
+			return err
+		}
+		report("Восстановление кеша по одному заказу (до)", c.GetStats().TotalOrders, m)
+	}
+
+	service := services.NewOrderService(repo, cache.NewOrderCache(logger), cache.NewNegativeCache(0), validator.NewLenientDecoder(), validator.NewDefault(), logger)
+	m, err := measure(func() error { return service.RestoreCache(ctx) })
+	if err != nil {
+		return fmt.Errorf("failed to restore cache: %w", err)
+	}
+	report("Восстановление кеша пачками (после)", service.GetCacheStats().TotalOrders, m)
+	return nil
+}
+
+type measurement struct {
+	elapsed time.Duration
+	alloc   uint64
+}
+
+func measure(fn func() error) (measurement, error) {
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	err := fn()
+	m := measurement{elapsed: time.Since(start)}
+	runtime.ReadMemStats(&after)
+	m.alloc = after.TotalAlloc - before.TotalAlloc
+	return m, err
+}
+
+func report(title string, orders int, m measurement) {
+	fmt.Printf("=== %s ===\n", title)
+	fmt.Printf("Заказов в кеше: %d\n", orders)
+	fmt.Printf("Время: %v\n", m.elapsed)
+	fmt.Printf("Заказов в секунду: %.0f\n", float64(orders)/m.elapsed.Seconds())
+	fmt.Printf("Выделено памяти: %d MB\n\n", m.alloc/1024/1024)
+}
+
+// restorePerOrder loads the cache the way it was done before orders were
+// read with set-based queries: one query for the IDs, then four queries per
+// order for the order, its delivery, its payment and its items.
+func restorePerOrder(ctx context.Context, pool *pgxpool.Pool, c cache.OrderCache) error {
+	rows, err := pool.Query(ctx, "SELECT order_uid FROM orders")
+	if err != nil {
+		return fmt.Errorf("failed to query orders: %w", err)
+	}
+	var uids []string
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan order ID: %w", err)
+		}
+		uids = append(uids, uid)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read order IDs: %w", err)
+	}
+
+	for _, uid := range uids {
+		order, err := loadOrder(ctx, pool, uid)
+		if err != nil {
+			return err
+		}
+		c.LoadFromDB([]models.Order{order})
+	}
+	return nil
+}
+
+func loadOrder(ctx context.Context, pool *pgxpool.Pool, uid string) (models.Order, error) {
+	var o models.Order
+	var signature *string
+	if err := pool.QueryRow(ctx, `
+        SELECT order_uid, track_number, entry, locale, internal_signature,
+            customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard,
+            version, updated_at
+        FROM orders WHERE order_uid = $1`, uid,
+	).Scan(
+		&o.OrderUID, &o.TrackNumber, &o.Entry, &o.Locale, &signature,
+		&o.CustomerID, &o.DeliveryService, &o.ShardKey, &o.SmID, &o.DateCreated, &o.OofShard,
+		&o.Version, &o.UpdatedAt,
+	); err != nil {
+		return o, fmt.Errorf("failed to get order: %w", err)
+	}
+	if signature != nil {
+		o.InternalSignature = *signature
+	}
+
+	d := &o.Delivery
+	if err := pool.QueryRow(ctx, `
+        SELECT name, phone, zip, city, address, region, email
+        FROM deliveries WHERE order_uid = $1`, uid,
+	).Scan(&d.Name, &d.Phone, &d.Zip, &d.City, &d.Address, &d.Region, &d.Email); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return o, fmt.Errorf("failed to get delivery: %w", err)
+	}
+
+	p := &o.Payment
+	var requestID *string
+	if err := pool.QueryRow(ctx, `
+        SELECT transaction, request_id, currency, provider, amount,
+            payment_dt, bank, delivery_cost, goods_total, custom_fee
+        FROM payments WHERE order_uid = $1`, uid,
+	).Scan(
+		&p.Transaction, &requestID, &p.Currency, &p.Provider, &p.Amount,
+		&p.PaymentDt, &p.Bank, &p.DeliveryCost, &p.GoodsTotal, &p.CustomFee,
+	); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return o, fmt.Errorf("failed to get payment: %w", err)
+	}
+	if requestID != nil {
+		p.RequestID = *requestID
+	}
+
+	rows, err := pool.Query(ctx, `
+        SELECT chrt_id, track_number, price, rid, name, sale,
+            size, total_price, nm_id, brand, status
+        FROM items WHERE order_uid = $1 ORDER BY id`, uid,
+	)
+	if err != nil {
+		return o, fmt.Errorf("failed to query items: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var it models.Item
+		if err := rows.Scan(
+			&it.ChrtID, &it.TrackNumber, &it.Price, &it.RID, &it.Name, &it.Sale,
+			&it.Size, &it.TotalPrice, &it.NmID, &it.Brand, &it.Status,
+		); err != nil {
+			return o, fmt.Errorf("failed to scan item: %w", err)
+		}
+		o.Items = append(o.Items, it)
+	}
+	return o, rows.Err()
+}
+
+func benchOrder(i int) models.Order {
+	uid := fmt.Sprintf("bench-%08d", i)
+	track := fmt.Sprintf("WBILMBENCH%08d", i)
+	return models.Order{
+		OrderUID:        uid,
+		TrackNumber:     track,
+		Entry:           "WBIL",
+		Locale:          "en",
+		CustomerID:      fmt.Sprintf("customer-%d", i%1000),
+		DeliveryService: "meest",
+		ShardKey:        "9",
+		SmID:            99,
+		DateCreated:     time.Now().UTC().Truncate(time.Second),
+		OofShard:        "1",
+		Delivery: models.Delivery{
+			Name:    "Test Testov",
+			Phone:   "+9720000000",
+			Zip:     "2639809",
+			City:    "Kiryat Mozkin",
+			Address: "Ploshad Mira 15",
+			Region:  "Kraiot",
+			Email:   "test@gmail.com",
+		},
+		Payment: models.Payment{
+			Transaction:  uid,
+			Currency:     "USD",
+			Provider:     "wbpay",
+			Amount:       1817,
+			PaymentDt:    1637907727,
+			Bank:         "alpha",
+			DeliveryCost: 1500,
+			GoodsTotal:   317,
+		},
+		Items: []models.Item{
+			{ChrtID: 9934930, TrackNumber: track, Price: 453, RID: uid + "-1", Name: "Mascaras",
+				Sale: 30, Size: "0", TotalPrice: 317, NmID: 2389212, Brand: "Vivienne Sabo", Status: 202},
+		},
+	}
+}
@@ -41,6 +41,14 @@ func main() {
 			name:    "Не JSON",
 			message: `это не JSON сообщение`,
 		},
+		{
+			name:    "Неверный тип поля",
+			message: `{"order_uid": "wrong_type", "sm_id": "99", "items": {}}`,
+		},
+		{
+			name:    "Дата не в UTC",
+			message: `{"order_uid": "local_date", "date_created": "2021-11-26T09:22:19+03:00"}`,
+		},
 	}
 
 	for i, invalid := range invalidMessages {
@@ -85,6 +85,10 @@ func main() {
 	for i := 1; i <= 10; i++ {
 		orderUID := fmt.Sprintf("order_%d_%d", i, time.Now().Unix())
 		trackNumber := fmt.Sprintf("TRACK%d%d", i, rand.Intn(1000))
+		price := rand.Intn(1000) + 100
+		sale := rand.Intn(50)
+		totalPrice := price * (100 - sale) / 100
+		deliveryCost := rand.Intn(500) + 200
 
 		order := Order{
 			OrderUID:          orderUID,
@@ -96,7 +100,7 @@ func main() {
 			DeliveryService:   "meest",
 			ShardKey:          fmt.Sprintf("%d", rand.Intn(10)),
 			SmID:              99 + i,
-			DateCreated:       time.Now().Add(-time.Duration(i) * time.Hour),
+			DateCreated:       time.Now().UTC().Add(-time.Duration(i) * time.Hour),
 			OofShard:          "1",
 			Delivery: Delivery{
 				Name:    names[rand.Intn(len(names))],
@@ -112,23 +116,23 @@ func main() {
 				RequestID:    "",
 				Currency:     currencies[rand.Intn(len(currencies))],
 				Provider:     "wbpay",
-				Amount:       rand.Intn(5000) + 500,
+				Amount:       totalPrice + deliveryCost,
 				PaymentDt:    time.Now().Unix(),
 				Bank:         banks[rand.Intn(len(banks))],
-				DeliveryCost: rand.Intn(500) + 200,
-				GoodsTotal:   rand.Intn(4000) + 300,
+				DeliveryCost: deliveryCost,
+				GoodsTotal:   totalPrice,
 				CustomFee:    0,
 			},
 			Items: []Item{
 				{
 					ChrtID:      9934930 + i,
 					TrackNumber: trackNumber,
-					Price:       rand.Intn(1000) + 100,
+					Price:       price,
 					RID:         fmt.Sprintf("rid_%d_%d", i, rand.Intn(1000)),
 					Name:        products[rand.Intn(len(products))],
-					Sale:        rand.Intn(50),
+					Sale:        sale,
 					Size:        "0",
-					TotalPrice:  rand.Intn(800) + 100,
+					TotalPrice:  totalPrice,
 					NmID:        2389212 + i,
 					Brand:       brands[rand.Intn(len(brands))],
 					Status:      202,
@@ -143,7 +147,8 @@ func main() {
 		}
 
 		err = writer.WriteMessages(ctx, kafka.Message{
-			Value: orderJSON,
+			Value:   orderJSON,
+			Headers: []kafka.Header{{Key: "x-schema-version", Value: []byte("1")}},
 		})
 		if err != nil {
 			log.Printf("Failed to send order %d: %v", i, err)
@@ -74,7 +74,7 @@ func main() {
 		DeliveryService:   "meest",
 		ShardKey:          "9",
 		SmID:              99,
-		DateCreated:       time.Now(),
+		DateCreated:       time.Now().UTC(),
 		OofShard:          "1",
 		Delivery: Delivery{
 			Name:    "Test Testov",
@@ -128,7 +128,8 @@ func main() {
 
 	ctx := context.Background()
 	err = writer.WriteMessages(ctx, kafka.Message{
-		Value: orderJSON,
+		Value:   orderJSON,
+		Headers: []kafka.Header{{Key: "x-schema-version", Value: []byte("1")}},
 	})
 	if err != nil {
 		log.Fatalf("failed to send message: %v", err)